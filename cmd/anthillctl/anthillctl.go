@@ -0,0 +1,468 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/audit"
+	"github.com/uwine4850/anthill/pkg/infra/jobs"
+	"github.com/uwine4850/anthill/pkg/infra/plug"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+	"github.com/uwine4850/anthill/pkg/infra/runner"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+	"github.com/uwine4850/anthill/pkg/infra/status"
+)
+
+const usage = `usage: anthillctl [--host host:port] [--context name] <command> [flags] [args]
+
+commands:
+  run      [-l selector] [--timeout d] [--wait] [name]
+  run      --all [--dry-run] [--on-failure stop|rollback] [--timeout d]
+  stop     [-l selector | --all] [name]
+  restart  [-l selector | --all] [--parallel n] [name]
+  scale    <name> <replicas>
+  status   [-l selector] [name]
+  logs     [--history] [--json] [--since t] [--until t] [--stderr-only] [--grep re] <name>
+  logs     [-l selector | --all] [--json] [--no-color] [--since t] [--stderr-only] [--grep re]
+  plugins  list
+  jobs
+  job      <id>
+  cancel   <id>
+  pipeline run [--wait] <name>
+  pipeline resume [--from step] [--wait] <run-id>
+  pipeline status <run-id>
+  pipeline history [name]
+  reload
+  audit    [--since t] [--json]
+  context  [list | use <name> | add <name> [--host h] [--ca f] [--cert f] [--key f]]
+`
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	host := flag.String("host", "", "orchestrator TLS listener, overrides ANTHILL_HOST and the context")
+	contextName := flag.String("context", "", "named orchestrator context, overrides ANTHILL_CONTEXT")
+	flag.Parse()
+	args := flag.Args()
+	if len(args) < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	commands := map[string]func(args []string) error{
+		"run":      runCommand,
+		"stop":     stopCommand,
+		"restart":  restartCommand,
+		"scale":    scaleCommand,
+		"status":   statusCommand,
+		"logs":     logsCommand,
+		"plugins":  pluginsCommand,
+		"jobs":     jobsCommand,
+		"job":      jobCommand,
+		"cancel":   cancelCommand,
+		"pipeline": pipelineCommand,
+		"reload":   reloadCommand,
+		"context":  contextCommand,
+		"audit":    auditCommand,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := setTarget(*host, *contextName); err != nil {
+		log.Fatalln(err)
+	}
+	if err := command(args[1:]); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+type targetFlags struct {
+	set      *flag.FlagSet
+	selector string
+	all      bool
+}
+
+func newTargetFlags(name string) *targetFlags {
+	f := &targetFlags{set: flag.NewFlagSet(name, flag.ExitOnError)}
+	f.set.StringVar(&f.selector, "l", "", "label selector, e.g. group=ingest,env!=dev")
+	f.set.BoolVar(&f.all, "all", false, "target all workers")
+	return f
+}
+
+func (f *targetFlags) name() (string, error) {
+	if f.selector != "" || f.all {
+		return "", nil
+	}
+	if f.set.NArg() != 1 {
+		return "", fmt.Errorf("%s: expected a worker name, a selector or --all", f.set.Name())
+	}
+	return f.set.Arg(0), nil
+}
+
+// newRunner reads the local workers config. A remote orchestrator validates
+// the requests against its own config.
+func newRunner() (*runner.Runner, error) {
+	r := runner.NewRunner("workers.yaml")
+	if socket.IsRemote() {
+		return &r, nil
+	}
+	if err := r.Init(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func runCommand(args []string) error {
+	f := newTargetFlags("run")
+	timeout := f.set.Duration("timeout", 0, "cancel starts still waiting for dependencies after the duration, e.g. 30s")
+	dryRun := f.set.Bool("dry-run", false, "with --all, only print the start plan")
+	onFailure := f.set.String("on-failure", runner.ON_FAILURE_STOP, "with --all, stop the plan or also roll back the started workers")
+	wait := f.set.Bool("wait", false, "wait until the worker exits and exit with its exit code")
+	f.set.Parse(args)
+	name, err := f.name()
+	if err != nil {
+		return err
+	}
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+	r.SetTimeout(*timeout)
+	switch {
+	case f.selector != "":
+		return printResults(r.RunSelector(f.selector))
+	case f.all:
+		stages, err := r.Plan()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(stages); i++ {
+			fmt.Printf("stage %d: %s\n", i+1, strings.Join(stages[i], ", "))
+		}
+		if *dryRun {
+			return nil
+		}
+		return r.RunPlan(stages, *onFailure)
+	case *wait:
+		workerStatus, err := r.RunAndWait(name)
+		if err != nil {
+			return err
+		}
+		printStatus(*workerStatus, "")
+		if !workerStatus.Done {
+			os.Exit(max(workerStatus.ExitCode, 1))
+		}
+		return nil
+	default:
+		if err := r.RunWorker(name); err != nil {
+			return err
+		}
+	}
+	r.Wait()
+	return nil
+}
+
+func stopCommand(args []string) error {
+	f := newTargetFlags("stop")
+	f.set.Parse(args)
+	name, err := f.name()
+	if err != nil {
+		return err
+	}
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+	if f.selector != "" {
+		return printResults(r.StopSelector(f.selector))
+	}
+	if f.all {
+		return printResults(r.StopAllWorkers())
+	}
+	return r.StopWorker(name)
+}
+
+func restartCommand(args []string) error {
+	f := newTargetFlags("restart")
+	parallel := f.set.Int("parallel", 1, "number of workers restarted at a time")
+	f.set.Parse(args)
+	name, err := f.name()
+	if err != nil {
+		return err
+	}
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+	switch {
+	case f.selector != "":
+		return printResults(r.RestartSelector(f.selector, *parallel))
+	case f.all:
+		return printResults(r.RestartAllWorkers(*parallel))
+	default:
+		return printResults(r.RestartWorker(name))
+	}
+}
+
+func scaleCommand(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("scale: expected <name> <replicas>")
+	}
+	replicas, err := strconv.Atoi(args[1])
+	if err != nil {
+		return fmt.Errorf("scale: invalid number of replicas <%s>", args[1])
+	}
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+	return printResults(r.ScaleWorker(args[0], replicas))
+}
+
+func statusCommand(args []string) error {
+	f := newTargetFlags("status")
+	f.set.Parse(args)
+	switch {
+	case f.selector != "":
+		workersStatus, err := status.CheckSelectorStatus(f.selector)
+		if err != nil {
+			return err
+		}
+		for _, workerStatus := range workersStatus {
+			printStatus(workerStatus, "")
+		}
+		return nil
+	case f.set.NArg() == 1:
+		workerStatus, err := status.CheckStatus(f.set.Arg(0))
+		if err != nil {
+			return err
+		}
+		printStatus(*workerStatus, "")
+		return nil
+	default:
+		return status.CheckAllStatus()
+	}
+}
+
+func printStatus(workerStatus status.WorkerStatusData, indent string) {
+	fmt.Printf("%sName: %s | Active: %v | Ready: %v | Done: %v | UpDate: %s%s\n", indent, workerStatus.Name, workerStatus.Active,
+		workerStatus.Ready, workerStatus.Done, workerStatus.UpDate.Format("2006-01-02 15:04"), status.FailureText(workerStatus))
+	for i := 0; i < len(workerStatus.Replicas); i++ {
+		printStatus(workerStatus.Replicas[i], indent+"  ")
+	}
+}
+
+func logsCommand(args []string) error {
+	set := flag.NewFlagSet("logs", flag.ExitOnError)
+	history := set.Bool("history", false, "read the stored log files instead of the live stream")
+	selector := set.String("l", "", "follow the workers matched by the label selector")
+	all := set.Bool("all", false, "follow all workers")
+	opts, err := readOptionsFlags(set, args)
+	if err != nil {
+		return err
+	}
+	if *selector != "" || *all {
+		r, err := newRunner()
+		if err != nil {
+			return err
+		}
+		return process.ReadStreams(func() ([]dmnsocket.WorkerResult, error) {
+			return r.LogTargets(*selector, *all)
+		}, *opts)
+	}
+	if set.NArg() != 1 {
+		return fmt.Errorf("logs: expected a worker name")
+	}
+	name := set.Arg(0)
+	if !*history {
+		err := process.ReadStream(name, *opts)
+		if err == nil {
+			return nil
+		}
+		log.Println(err)
+	}
+	r, err := newRunner()
+	if err != nil {
+		return err
+	}
+	logDir, err := r.LogDir(name)
+	if err != nil {
+		return err
+	}
+	return process.ReadHistory(logDir, name, *opts)
+}
+
+func readOptionsFlags(set *flag.FlagSet, args []string) (*process.ReadOptions, error) {
+	opts := &process.ReadOptions{}
+	set.BoolVar(&opts.JSON, "json", false, "print records as JSON lines")
+	set.BoolVar(&opts.StderrOnly, "stderr-only", false, "print only stderr records")
+	set.BoolVar(&opts.NoColor, "no-color", false, "do not color worker names")
+	since := set.String("since", "", "print records since an RFC 3339 time or a duration ago, e.g. 10m")
+	until := set.String("until", "", "print records until an RFC 3339 time or a duration ago")
+	grep := set.String("grep", "", "print records whose line matches the regular expression")
+	set.Parse(args)
+
+	var err error
+	if *since != "" {
+		if opts.Since, err = process.ParseTime(*since); err != nil {
+			return nil, err
+		}
+	}
+	if *until != "" {
+		if opts.Until, err = process.ParseTime(*until); err != nil {
+			return nil, err
+		}
+	}
+	if *grep != "" {
+		if opts.Grep, err = regexp.Compile(*grep); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func pluginsCommand(args []string) error {
+	if len(args) != 1 || args[0] != "list" {
+		return fmt.Errorf("plugins: expected list")
+	}
+	plugins, err := plug.ListPlugins()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tKIND\tNAME\tVERSION\tSOURCE\tPATH\tERROR")
+	for _, p := range plugins {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Type, p.Kind, p.Name, p.Version, p.Source, p.Path, p.Error)
+	}
+	return w.Flush()
+}
+
+func jobsCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("jobs: unexpected arguments")
+	}
+	list, err := jobs.ListJobs()
+	if err != nil {
+		return err
+	}
+	return printJobs(list)
+}
+
+func jobCommand(args []string) error {
+	id, err := jobID("job", args)
+	if err != nil {
+		return err
+	}
+	job, err := jobs.GetJob(id)
+	if err != nil {
+		return err
+	}
+	return printJobs([]jobs.Job{*job})
+}
+
+func cancelCommand(args []string) error {
+	id, err := jobID("cancel", args)
+	if err != nil {
+		return err
+	}
+	job, err := jobs.CancelJob(id)
+	if err != nil {
+		return err
+	}
+	return printJobs([]jobs.Job{*job})
+}
+
+func jobID(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s: expected a job id", command)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid job id <%s>", command, args[0])
+	}
+	return id, nil
+}
+
+func printJobs(list []jobs.Job) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tWORKER\tSTATE\tAFTER\tCREATED\tERROR")
+	for _, job := range list {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", job.ID, job.Worker, job.State, strings.Join(job.After, ","),
+			job.Created.Format(time.RFC3339), job.Error)
+	}
+	return w.Flush()
+}
+
+func reloadCommand(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("reload: unexpected arguments")
+	}
+	r := runner.NewRunner("workers.yaml")
+	return printResults(r.Reload())
+}
+
+func auditCommand(args []string) error {
+	set := flag.NewFlagSet("audit", flag.ExitOnError)
+	since := set.String("since", "", "print entries since an RFC 3339 time or a duration ago, e.g. 24h")
+	asJSON := set.Bool("json", false, "print entries as JSON lines")
+	set.Parse(args)
+	var sinceTime time.Time
+	if *since != "" {
+		var err error
+		if sinceTime, err = process.ParseTime(*since); err != nil {
+			return err
+		}
+	}
+	resp, err := audit.ReadAudit(sinceTime)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, entry := range resp.Entries {
+			if err := enc.Encode(entry); err != nil {
+				return err
+			}
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tPEER\tACTION\tTARGET\tOUTCOME")
+		for _, entry := range resp.Entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Time.Format(time.RFC3339), entry.Peer, entry.Action, entry.Target, entry.Outcome)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("head: %d entries, hash %s\n", resp.Head.Entries, resp.Head.Hash)
+	}
+	if resp.Tampered != "" {
+		return errors.New(resp.Tampered)
+	}
+	return nil
+}
+
+func printResults(results []dmnsocket.WorkerResult, err error) error {
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Printf("%s: %s\n", result.Name, result.Error)
+		} else if result.Job != 0 {
+			fmt.Printf("%s: pending, job %d\n", result.Name, result.Job)
+		} else {
+			fmt.Printf("%s: ok\n", result.Name)
+		}
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+	"gopkg.in/yaml.v3"
+)
+
+// contextsConfig is the file of named orchestrators, by default ~/.anthill/config.yaml.
+//
+//	current_context: prod
+//	contexts:
+//	  - name: prod
+//	    host: prod.example.com:7443
+//	    ca: ca.pem
+//	    cert: client.pem
+//	    key: client-key.pem
+//
+// A context without a host is the local orchestrator socket.
+type contextsConfig struct {
+	CurrentContext string `yaml:"current_context"`
+	Contexts       []orchestratorContext
+}
+
+type orchestratorContext struct {
+	Name       string
+	Host       string
+	CA         string
+	Cert       string
+	Key        string
+	ServerName string `yaml:"server_name"`
+}
+
+func contextsPath() (string, error) {
+	if path := os.Getenv("ANTHILL_CONFIG"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".anthill", "config.yaml"), nil
+}
+
+func loadContexts() (*contextsConfig, error) {
+	var contexts contextsConfig
+	path, err := contextsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &contexts, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &contexts); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return &contexts, nil
+}
+
+func (c *contextsConfig) save() error {
+	path, err := contextsPath()
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (c *contextsConfig) find(name string) (*orchestratorContext, error) {
+	for i := 0; i < len(c.Contexts); i++ {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("context <%s> not exists", name)
+}
+
+// setTarget selects the orchestrator. The context is taken from the flag, the
+// ANTHILL_CONTEXT env or the current context; the host flag or the ANTHILL_HOST
+// env replaces the host of the context.
+func setTarget(host string, contextName string) error {
+	if host == "" {
+		host = os.Getenv("ANTHILL_HOST")
+	}
+	if contextName == "" {
+		contextName = os.Getenv("ANTHILL_CONTEXT")
+	}
+	contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	if contextName == "" {
+		contextName = contexts.CurrentContext
+	}
+	target := socket.Target{}
+	if contextName != "" {
+		ctx, err := contexts.find(contextName)
+		if err != nil {
+			return err
+		}
+		target = socket.Target{Host: ctx.Host, CA: ctx.CA, Cert: ctx.Cert, Key: ctx.Key, ServerName: ctx.ServerName}
+	}
+	if host != "" {
+		target.Host = host
+	}
+	target.Host = strings.TrimPrefix(target.Host, "tcp://")
+	if target.Host == "local" || strings.HasPrefix(target.Host, "unix://") {
+		target.Host = ""
+	}
+	socket.SetTarget(target)
+	return nil
+}
+
+func contextCommand(args []string) error {
+	set := flag.NewFlagSet("context", flag.ExitOnError)
+	set.Parse(args)
+	contexts, err := loadContexts()
+	if err != nil {
+		return err
+	}
+	switch {
+	case set.NArg() == 0 || set.Arg(0) == "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "CURRENT\tNAME\tHOST")
+		for _, ctx := range contexts.Contexts {
+			current := ""
+			if ctx.Name == contexts.CurrentContext {
+				current = "*"
+			}
+			host := ctx.Host
+			if host == "" {
+				host = "local"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, ctx.Name, host)
+		}
+		return w.Flush()
+	case set.Arg(0) == "use" && set.NArg() == 2:
+		if _, err := contexts.find(set.Arg(1)); err != nil {
+			return err
+		}
+		contexts.CurrentContext = set.Arg(1)
+		return contexts.save()
+	case set.Arg(0) == "add" && set.NArg() >= 2:
+		return addContext(contexts, set.Arg(1), set.Args()[2:])
+	default:
+		return fmt.Errorf("context: expected list, use <name> or add <name>")
+	}
+}
+
+func addContext(contexts *contextsConfig, name string, args []string) error {
+	set := flag.NewFlagSet("context add", flag.ExitOnError)
+	ctx := orchestratorContext{Name: name}
+	set.StringVar(&ctx.Host, "host", "", "host:port of the orchestrator TLS listener, empty for the local socket")
+	set.StringVar(&ctx.CA, "ca", "", "CA certificate of the orchestrator")
+	set.StringVar(&ctx.Cert, "cert", "", "client certificate")
+	set.StringVar(&ctx.Key, "key", "", "client key")
+	set.StringVar(&ctx.ServerName, "server-name", "", "name in the orchestrator certificate if it differs from the host")
+	set.Parse(args)
+	if existing, err := contexts.find(name); err == nil {
+		*existing = ctx
+	} else {
+		contexts.Contexts = append(contexts.Contexts, ctx)
+	}
+	return contexts.save()
+}
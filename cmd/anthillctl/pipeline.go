@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	"github.com/uwine4850/anthill/pkg/infra/pipeline"
+)
+
+func pipelineCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("pipeline: expected run, status, resume or history")
+	}
+	set := flag.NewFlagSet("pipeline "+args[0], flag.ExitOnError)
+	wait := set.Bool("wait", false, "wait until the run is finished and exit with an error if it failed")
+	from := set.String("from", "", "step the resumed run starts from, by default the first failed step")
+	set.Parse(args[1:])
+
+	var run *pipeline.Run
+	var err error
+	switch {
+	case args[0] == "run" && set.NArg() == 1:
+		run, err = pipeline.RunPipeline(set.Arg(0))
+	case args[0] == "resume" && set.NArg() == 1:
+		var id int
+		if id, err = runID(set.Arg(0)); err == nil {
+			run, err = pipeline.ResumePipeline(id, *from)
+		}
+	case args[0] == "status" && set.NArg() == 1:
+		var id int
+		if id, err = runID(set.Arg(0)); err == nil {
+			run, err = pipeline.GetRun(id)
+		}
+	case args[0] == "history" && set.NArg() <= 1:
+		runs, err := pipeline.ListRuns(set.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printRuns(runs)
+	default:
+		return fmt.Errorf("pipeline: unexpected arguments %v", args)
+	}
+	if err != nil {
+		return err
+	}
+	for *wait && run.State == pipeline.STATE_RUNNING {
+		time.Sleep(config.JOB_POLL_INTERVAL)
+		if run, err = pipeline.GetRun(run.ID); err != nil {
+			return err
+		}
+	}
+	if err := printRun(run); err != nil {
+		return err
+	}
+	if *wait && run.State == pipeline.STATE_FAILED {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func runID(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("pipeline: invalid run id <%s>", arg)
+	}
+	return id, nil
+}
+
+func printRun(run *pipeline.Run) error {
+	fmt.Printf("run %d of %s: %s", run.ID, run.Pipeline, run.State)
+	if run.ResumedFrom != 0 {
+		fmt.Printf(" (resumed from run %d)", run.ResumedFrom)
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tWORKER\tSTATE\tDURATION\tEXIT\tERROR")
+	for _, step := range run.Steps {
+		state := string(step.State)
+		if step.Reused {
+			state += " (reused)"
+		}
+		duration := ""
+		if step.Duration != 0 {
+			duration = step.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", step.Name, step.Worker, state, duration, step.ExitCode, step.Error)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, step := range run.Steps {
+		for _, key := range slices.Sorted(maps.Keys(step.Outputs)) {
+			fmt.Printf("steps.%s.outputs.%s = %s\n", step.Name, key, step.Outputs[key])
+		}
+	}
+	return nil
+}
+
+func printRuns(runs []pipeline.Run) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPIPELINE\tSTATE\tSTARTED\tDURATION\tRESUMED FROM")
+	for _, run := range runs {
+		duration := ""
+		if !run.Finished.IsZero() {
+			duration = run.Finished.Sub(run.Started).Round(time.Millisecond).String()
+		}
+		resumedFrom := ""
+		if run.ResumedFrom != 0 {
+			resumedFrom = strconv.Itoa(run.ResumedFrom)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", run.ID, run.Pipeline, run.State, run.Started.Format(time.RFC3339), duration, resumedFrom)
+	}
+	return w.Flush()
+}
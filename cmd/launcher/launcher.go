@@ -1,6 +1,7 @@
 package main
 
 import (
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -23,6 +24,7 @@ func main() {
 		if err := workerAnt.Stop(); err != nil {
 			log.Fatalln(err)
 		}
+		closePlugin(workerAnt)
 		os.Exit(0)
 	}()
 	if len(os.Args) > 2 {
@@ -33,4 +35,14 @@ func main() {
 	if err := workerAnt.Run(); err != nil {
 		log.Fatalln(err)
 	}
+	closePlugin(workerAnt)
+}
+
+// closePlugin stops executable plugins, which run as a child of the launcher.
+func closePlugin(workerAnt any) {
+	if closer, ok := workerAnt.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Println(err)
+		}
+	}
 }
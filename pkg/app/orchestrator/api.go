@@ -0,0 +1,331 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+)
+
+// serveAPI serves the HTTP API. Every endpoint is translated into a socket request
+// and handled by handleRequest, so responses have the same JSON shape as on the socket.
+//
+//	GET  /workers[?selector=s]          status of all or the selected workers
+//	GET  /workers/{name}                status of the worker
+//	POST /workers/{name}/run            run the worker, ?timeout=d cancels a start
+//	                                    still waiting for dependencies
+//	POST /workers/{name}/stop           stop the worker
+//	POST /workers/{name}/restart        restart the worker
+//	GET  /workers/{name}/logs           follow the worker logs as JSON lines, or as
+//	                                    server-sent events with Accept: text/event-stream
+//	GET  /jobs                          pending and finished starts of dependent workers
+//	GET  /jobs/{id}                     state of the job
+//	POST /jobs/{id}/cancel              cancel the job if it is still pending
+//	POST /pipelines/{name}/run          start a run of the pipeline
+//	GET  /pipelines/runs[?pipeline=p]   runs of all pipelines or of the pipeline
+//	GET  /pipelines/runs/{id}           steps of the run
+//	POST /pipelines/runs/{id}/resume    rerun the run from ?from=step, by default
+//	                                    from its first failed step
+//	POST /reload                        read the configs again
+//
+// If access control is enabled, requests must have an "Authorization: Bearer <token>" header.
+func (o *Orchestrator) serveAPI(address string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /workers", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "status", Selector: r.URL.Query().Get("selector")}
+		if peer, ok := o.authorizeHTTP(w, r, req); ok {
+			o.serveRequest(w, r, req, peer, http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("GET /workers/{name}", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "status", Name: r.PathValue("name")}
+		if peer, ok := o.authorizeHTTP(w, r, req); ok {
+			o.serveWorkerRequest(w, r, req, peer)
+		}
+	})
+	for _, action := range []string{"run", "stop", "restart"} {
+		mux.HandleFunc("POST /workers/{name}/"+action, func(w http.ResponseWriter, r *http.Request) {
+			req := dmnsocket.Request{Action: action, Name: r.PathValue("name")}
+			peer, ok := o.authorizeHTTP(w, r, req)
+			if !ok {
+				return
+			}
+			if parallel := r.URL.Query().Get("parallel"); parallel != "" {
+				n, err := strconv.Atoi(parallel)
+				if err != nil {
+					writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid parallel <%s>", parallel))
+					return
+				}
+				req.Parallel = n
+			}
+			if timeout := r.URL.Query().Get("timeout"); timeout != "" {
+				d, err := time.ParseDuration(timeout)
+				if err != nil {
+					writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout <%s>", timeout))
+					return
+				}
+				req.Deadline = time.Now().Add(d)
+			}
+			o.serveWorkerRequest(w, r, req, peer)
+		})
+	}
+	mux.HandleFunc("GET /workers/{name}/logs", o.serveLogs)
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "jobs"}
+		if peer, ok := o.authorizeHTTP(w, r, req); ok {
+			o.serveRequest(w, r, req, peer, http.StatusInternalServerError)
+		}
+	})
+	for _, action := range []string{"job", "cancel"} {
+		pattern := "GET /jobs/{id}"
+		if action == "cancel" {
+			pattern = "POST /jobs/{id}/cancel"
+		}
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.Atoi(r.PathValue("id"))
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid job <%s>", r.PathValue("id")))
+				return
+			}
+			req := dmnsocket.Request{Action: action, Job: id}
+			peer, ok := o.authorizeHTTP(w, r, req)
+			if !ok {
+				return
+			}
+			if _, err := o.jobs.Get(id); err != nil {
+				o.recordAudit(time.Now(), peer, req, "error: "+err.Error())
+				writeAPIError(w, http.StatusNotFound, err)
+				return
+			}
+			o.serveRequest(w, r, req, peer, http.StatusConflict)
+		})
+	}
+	mux.HandleFunc("POST /pipelines/{name}/run", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "pipeline_run", Name: r.PathValue("name")}
+		peer, ok := o.authorizeHTTP(w, r, req)
+		if !ok {
+			return
+		}
+		if _, err := o.pipelineConfig(req.Name); err != nil {
+			o.recordAudit(time.Now(), peer, req, "error: "+err.Error())
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		o.serveRequest(w, r, req, peer, http.StatusConflict)
+	})
+	mux.HandleFunc("GET /pipelines/runs", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "pipeline_status", Name: r.URL.Query().Get("pipeline")}
+		if peer, ok := o.authorizeHTTP(w, r, req); ok {
+			o.serveRequest(w, r, req, peer, http.StatusNotFound)
+		}
+	})
+	for _, action := range []string{"pipeline_status", "pipeline_resume"} {
+		pattern := "GET /pipelines/runs/{id}"
+		if action == "pipeline_resume" {
+			pattern = "POST /pipelines/runs/{id}/resume"
+		}
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.Atoi(r.PathValue("id"))
+			if err != nil {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid pipeline run <%s>", r.PathValue("id")))
+				return
+			}
+			req := dmnsocket.Request{Action: action, Run: id, Step: r.URL.Query().Get("from")}
+			peer, ok := o.authorizeHTTP(w, r, req)
+			if !ok {
+				return
+			}
+			if _, err := o.pipelines.Get(id); err != nil {
+				o.recordAudit(time.Now(), peer, req, "error: "+err.Error())
+				writeAPIError(w, http.StatusNotFound, err)
+				return
+			}
+			o.serveRequest(w, r, req, peer, http.StatusConflict)
+		})
+	}
+	mux.HandleFunc("POST /reload", func(w http.ResponseWriter, r *http.Request) {
+		req := dmnsocket.Request{Action: "reload"}
+		if peer, ok := o.authorizeHTTP(w, r, req); ok {
+			o.serveRequest(w, r, req, peer, http.StatusConflict)
+		}
+	})
+	return o.httpServer(address, mux).ListenAndServe()
+}
+
+// httpServer bounds the time to read the request headers and their size.
+// Responses have no write timeout, because logs are followed on them.
+func (o *Orchestrator) httpServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: o.config.Limits.ReadTimeout,
+		MaxHeaderBytes:    int(o.config.Limits.MaxRequestBytes),
+	}
+}
+
+// authorizeHTTP checks the bearer token of the request if access control is enabled
+// and responds with 401 or 403 if the request is not allowed. It returns the peer
+// identified by the token name, or by the remote address without access control.
+func (o *Orchestrator) authorizeHTTP(w http.ResponseWriter, r *http.Request, req dmnsocket.Request) (*auth.Peer, bool) {
+	peer := &auth.Peer{Address: r.RemoteAddr}
+	if o.auth == nil {
+		return peer, true
+	}
+	deny := func(code int, err error) (*auth.Peer, bool) {
+		o.recordAudit(time.Now(), peer, req, "denied: "+err.Error())
+		if code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		writeAPIError(w, code, err)
+		return nil, false
+	}
+	value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return deny(http.StatusUnauthorized, errors.New("missing bearer token"))
+	}
+	role, name := o.auth.TokenRole(value)
+	if role == auth.ROLE_NONE {
+		return deny(http.StatusUnauthorized, errors.New("invalid bearer token"))
+	}
+	peer = &auth.Peer{Token: name}
+	if err := auth.Authorize(role, req.Action); err != nil {
+		return deny(http.StatusForbidden, err)
+	}
+	return peer, true
+}
+
+// serveWorkerRequest responds with 404 if the worker does not exist.
+func (o *Orchestrator) serveWorkerRequest(w http.ResponseWriter, r *http.Request, req dmnsocket.Request, peer *auth.Peer) {
+	if _, err := o.resolveTargets(dmnsocket.Request{Name: req.Name}); err != nil {
+		o.recordAudit(time.Now(), peer, req, "error: "+err.Error())
+		writeAPIError(w, http.StatusNotFound, err)
+		return
+	}
+	o.serveRequest(w, r, req, peer, http.StatusConflict)
+}
+
+// serveRequest writes the response of handleRequest. A response with an error is
+// sent with errorCode.
+func (o *Orchestrator) serveRequest(w http.ResponseWriter, r *http.Request, req dmnsocket.Request, peer *auth.Peer, errorCode int) {
+	var buf bytes.Buffer
+	if err := o.handleRequest(r.Context(), &buf, req, peer); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var resp struct {
+		Error string
+	}
+	code := http.StatusOK
+	if err := json.Unmarshal(buf.Bytes(), &resp); err == nil && resp.Error != "" {
+		code = errorCode
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// serveLogs follows the log stream of the worker until the client disconnects.
+// The since, until, grep and stderr_only query parameters filter the records.
+func (o *Orchestrator) serveLogs(w http.ResponseWriter, r *http.Request) {
+	req := dmnsocket.Request{Action: "logs", Name: r.PathValue("name"), Follow: true}
+	peer, ok := o.authorizeHTTP(w, r, req)
+	if !ok {
+		return
+	}
+	outcome := "ok"
+	defer func(start time.Time) {
+		o.recordAudit(start, peer, req, outcome)
+	}(time.Now())
+	fail := func(code int, err error) {
+		outcome = "error: " + err.Error()
+		writeAPIError(w, code, err)
+	}
+	names, err := o.resolveTargets(req)
+	if err != nil {
+		fail(http.StatusNotFound, err)
+		return
+	}
+	if len(names) != 1 {
+		fail(http.StatusBadRequest, fmt.Errorf("worker <%s> has replicas, follow one of %v", req.Name, names))
+		return
+	}
+	opts, err := apiReadOptions(r)
+	if err != nil {
+		fail(http.StatusBadRequest, err)
+		return
+	}
+	o.workerProcess(names[0])
+
+	flusher, _ := w.(http.Flusher)
+	sse := r.Header.Get("Accept") == "text/event-stream"
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	err = process.FollowStream(r.Context(), names[0], *opts, func(record dmnprocess.LogRecord) error {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if sse {
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", data)
+		}
+		if err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && r.Context().Err() == nil {
+		outcome = "error: " + err.Error()
+		fmt.Fprintf(w, "%s\n", err)
+	}
+}
+
+func apiReadOptions(r *http.Request) (*process.ReadOptions, error) {
+	query := r.URL.Query()
+	opts := &process.ReadOptions{StderrOnly: query.Get("stderr_only") == "true"}
+	var err error
+	if since := query.Get("since"); since != "" {
+		if opts.Since, err = process.ParseTime(since); err != nil {
+			return nil, err
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if opts.Until, err = process.ParseTime(until); err != nil {
+			return nil, err
+		}
+	}
+	if grep := query.Get("grep"); grep != "" {
+		if opts.Grep, err = regexp.Compile(grep); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(dmnsocket.Response{Error: err.Error()})
+}
@@ -0,0 +1,114 @@
+package orchestrator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/audit"
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+)
+
+// recordAudit appends the control request and its outcome to the audit log. Read-only
+// requests, which clients poll while they wait, are only recorded if they were denied.
+func (o *Orchestrator) recordAudit(start time.Time, peer *auth.Peer, req dmnsocket.Request, outcome string) {
+	if o.audit == nil {
+		return
+	}
+	if auth.ActionRole(req.Action) < auth.ROLE_OPERATOR && !strings.HasPrefix(outcome, "denied") {
+		return
+	}
+	entry := audit.Entry{
+		Time:    start,
+		Peer:    "unknown",
+		Action:  req.Action,
+		Target:  auditTarget(req),
+		Params:  auditParams(req),
+		Outcome: outcome,
+	}
+	if peer != nil {
+		entry.Peer = peer.String()
+	}
+	if err := o.audit.Append(entry); err != nil {
+		log.Printf("audit log error: %s\n", err)
+	}
+}
+
+func auditTarget(req dmnsocket.Request) string {
+	switch {
+	case req.Selector != "":
+		return "selector:" + req.Selector
+	case req.All:
+		return "all"
+	case req.Job != 0:
+		return "job:" + strconv.Itoa(req.Job)
+	case req.Run != 0:
+		return "run:" + strconv.Itoa(req.Run)
+	default:
+		return req.Name
+	}
+}
+
+func auditParams(req dmnsocket.Request) map[string]string {
+	params := map[string]string{}
+	if req.Parallel != 0 {
+		params["parallel"] = strconv.Itoa(req.Parallel)
+	}
+	if req.Action == "scale" {
+		params["replicas"] = strconv.Itoa(req.Replicas)
+	}
+	if req.Step != "" {
+		params["step"] = req.Step
+	}
+	if req.Follow {
+		params["follow"] = "true"
+	}
+	if !req.Deadline.IsZero() {
+		params["deadline"] = req.Deadline.Format(time.RFC3339)
+	}
+	if !req.Since.IsZero() {
+		params["since"] = req.Since.Format(time.RFC3339)
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// responseRecorder passes the response to the client and keeps its first line,
+// which holds the error of every response type.
+type responseRecorder struct {
+	w    io.Writer
+	line bytes.Buffer
+	done bool
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.done {
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			r.line.Write(p[:i])
+			r.done = true
+		} else {
+			r.line.Write(p)
+		}
+	}
+	return r.w.Write(p)
+}
+
+func (r *responseRecorder) outcome(err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	var resp struct {
+		Error string
+	}
+	if json.Unmarshal(r.line.Bytes(), &resp) == nil && resp.Error != "" {
+		return "error: " + resp.Error
+	}
+	return "ok"
+}
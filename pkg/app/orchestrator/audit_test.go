@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/audit"
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+)
+
+func TestRecordAuditControlActions(t *testing.T) {
+	dir := t.TempDir()
+	auditLog, err := audit.Open(filepath.Join(dir, "audit.log"), filepath.Join(dir, "audit.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	o := NewOrchestartor()
+	o.audit = auditLog
+
+	peer := &auth.Peer{UID: 1000}
+	o.recordAudit(time.Now(), peer, dmnsocket.Request{Action: "status"}, "ok")
+	o.recordAudit(time.Now(), peer, dmnsocket.Request{Action: "job", Job: 3}, "ok")
+	o.recordAudit(time.Now(), peer, dmnsocket.Request{Action: "status"}, "denied: permission denied")
+	o.recordAudit(time.Now(), peer, dmnsocket.Request{Action: "run", Name: "web"}, "ok")
+	o.recordAudit(time.Now(), peer, dmnsocket.Request{Action: "reload"}, "ok")
+
+	entries, _, tampered, err := auditLog.Read(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tampered != "" {
+		t.Fatal(tampered)
+	}
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action+" "+entry.Outcome)
+	}
+	want := []string{"status denied: permission denied", "run ok", "reload ok"}
+	if len(actions) != len(want) {
+		t.Fatalf("recorded %v, want %v", actions, want)
+	}
+	for i := 0; i < len(want); i++ {
+		if actions[i] != want[i] {
+			t.Fatalf("recorded %v, want %v", actions, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+)
+
+// Users other than the owner cannot connect to the stream sockets, they follow
+// the logs through the control socket, which requires the viewer role.
+func TestFollowLogsRequiresViewer(t *testing.T) {
+	authorizer, err := auth.NewAuthorizer(&parsecnf.AuthConfig{
+		DefaultRole: "none",
+		Users:       []parsecnf.RoleBinding{{Name: "65533", Role: "viewer"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := NewOrchestartor()
+	o.auth = authorizer
+	if err := o.authorizeConn(&auth.Peer{UID: 65534, GID: 65534}, nil, "logs"); err == nil {
+		t.Fatal("peer without a role may follow the logs")
+	}
+	if err := o.authorizeConn(&auth.Peer{UID: 65533, GID: 65533}, nil, "logs"); err != nil {
+		t.Fatalf("viewer may not follow the logs: %s", err)
+	}
+}
@@ -0,0 +1,181 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+)
+
+// jobRun is a running worker of kind job.
+type jobRun struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// slots holds the processes of the parallel runs after the first.
+	slots []dmnworker.AWorkerProcess
+}
+
+type attempt struct {
+	slot     int
+	exitCode int
+	err      error
+}
+
+// runJob starts the runs of a job worker. The status of the worker is set once the
+// job completes or fails, a stopped job is left to stopWorker.
+func (o *Orchestrator) runJob(name string, pluginAnt dmnworker.PluginAnt) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if pluginAnt.Job.ActiveDeadline > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), pluginAnt.Job.ActiveDeadline)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	run := &jobRun{cancel: cancel, done: make(chan struct{})}
+	o.processesMu.Lock()
+	if _, ok := o.jobRuns[name]; ok {
+		o.processesMu.Unlock()
+		cancel()
+		return fmt.Errorf("worker <%s> already running", name)
+	}
+	o.jobRuns[name] = run
+	o.processesMu.Unlock()
+	if err := o.status.SetRunning(name); err != nil {
+		log.Println(err)
+	}
+
+	go func() {
+		defer close(run.done)
+		exitCode, err := o.complete(ctx, name, pluginAnt)
+		cancel()
+		defer func() {
+			o.processesMu.Lock()
+			delete(o.jobRuns, name)
+			o.processesMu.Unlock()
+		}()
+		switch {
+		case errors.Is(err, context.Canceled):
+		case err != nil:
+			if err := o.status.SetFailed(name, exitCode, err.Error()); err != nil {
+				log.Println(err)
+			}
+		default:
+			if err := o.status.SetDone(name); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+	return nil
+}
+
+// stopJob stops the runs of the job worker and waits until they exited.
+// It reports false if the job is not running.
+func (o *Orchestrator) stopJob(name string) bool {
+	o.processesMu.Lock()
+	run, ok := o.jobRuns[name]
+	o.processesMu.Unlock()
+	if !ok {
+		return false
+	}
+	run.cancel()
+	<-run.done
+	return true
+}
+
+// complete runs the job until it has the configured number of successful runs.
+// It returns the exit code of the last failed run with the error of the job.
+func (o *Orchestrator) complete(ctx context.Context, name string, pluginAnt dmnworker.PluginAnt) (int, error) {
+	completions := max(pluginAnt.Job.Completions, 1)
+	parallelism := min(max(pluginAnt.Job.Parallelism, 1), completions)
+	slots := o.jobProcesses(name, pluginAnt, parallelism)
+	attempts := make(chan attempt)
+	running := 0
+	start := func(slot int) {
+		running++
+		go func() {
+			exitCode, err := runAttempt(slots[slot])
+			attempts <- attempt{slot: slot, exitCode: exitCode, err: err}
+		}()
+	}
+	stopAll := func() {
+		for i := 0; i < len(slots); i++ {
+			if err := slots[i].Stop(); err != nil && !errors.Is(err, process.ErrNotRunning) {
+				log.Printf("stop run of %s: %s\n", name, err)
+			}
+		}
+	}
+	for slot := 0; slot < parallelism; slot++ {
+		start(slot)
+	}
+
+	succeeded, failed, lastExitCode := 0, 0, 0
+	var jobErr error
+	cancelled := ctx.Done()
+	for running > 0 {
+		select {
+		case a := <-attempts:
+			running--
+			if jobErr != nil {
+				continue
+			}
+			if a.err == nil && a.exitCode == 0 {
+				succeeded++
+			} else {
+				failed++
+				lastExitCode = a.exitCode
+				if a.err != nil {
+					log.Printf("run of %s: %s\n", name, a.err)
+				}
+			}
+			if failed > pluginAnt.Job.Retries {
+				jobErr = fmt.Errorf("job failed %d times, last exit code %d", failed, lastExitCode)
+				go stopAll()
+				continue
+			}
+			if succeeded+running < completions {
+				start(a.slot)
+			}
+		case <-cancelled:
+			cancelled = nil
+			if jobErr == nil {
+				jobErr = ctx.Err()
+				if errors.Is(jobErr, context.DeadlineExceeded) {
+					jobErr = fmt.Errorf("active deadline %s exceeded", pluginAnt.Job.ActiveDeadline)
+					lastExitCode = -1
+				}
+				go stopAll()
+			}
+		}
+	}
+	return lastExitCode, jobErr
+}
+
+// jobProcesses returns a process per parallel run. The first is the process of the
+// worker, the others run as name#slot with their own outputs and write their records
+// with the slot to the log stream of the worker.
+func (o *Orchestrator) jobProcesses(name string, pluginAnt dmnworker.PluginAnt, parallelism int) []dmnworker.AWorkerProcess {
+	p := o.workerProcess(name)
+	p.SetPluginAnt(pluginAnt)
+	slots := []dmnworker.AWorkerProcess{p}
+	o.processesMu.Lock()
+	defer o.processesMu.Unlock()
+	streamer := o.streams[name]
+	for i := 1; i < parallelism; i++ {
+		slots = append(slots, o.antWorkerProcess.New(pluginAnt, dmnworker.SlotName(name, i), streamer.ForSlot(i)))
+	}
+	if run, ok := o.jobRuns[name]; ok {
+		run.slots = slots[1:]
+	}
+	return slots
+}
+
+func runAttempt(p dmnworker.AWorkerProcess) (int, error) {
+	if err := p.Run(); err != nil {
+		return -1, err
+	}
+	<-p.Done()
+	return p.Stats().ExitCode, nil
+}
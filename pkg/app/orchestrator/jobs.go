@@ -0,0 +1,76 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+	"github.com/uwine4850/anthill/pkg/infra/jobs"
+)
+
+// startWorkers starts the workers like forEachWorker. The results of workers that
+// wait for their dependencies hold the ID of their job.
+func (o *Orchestrator) startWorkers(names []string, deadline time.Time) ([]dmnsocket.WorkerResult, error) {
+	results := make([]dmnsocket.WorkerResult, len(names))
+	var wg sync.WaitGroup
+	for i := 0; i < len(names); i++ {
+		results[i].Name = names[i]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job, err := o.startWorker(names[i], deadline)
+			results[i].Job = job
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results, resultsError(results)
+}
+
+// cancelJob cancels the job if its worker is not started yet.
+func (o *Orchestrator) cancelJob(id int, reason string) error {
+	if _, ok := o.startAfterWorkerAnts.LoadAndDelete(id); !ok {
+		job, err := o.jobs.Get(id)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("job <%d> is %s", id, job.State)
+	}
+	o.jobs.Cancel(id, reason)
+	return nil
+}
+
+// cancelWorkerJobs cancels the pending jobs of a removed worker.
+func (o *Orchestrator) cancelWorkerJobs(name string) {
+	o.startAfterWorkerAnts.Range(func(key, value any) bool {
+		if value.(*afterWorker).Name == name {
+			o.cancelJob(key.(int), fmt.Sprintf("worker <%s> removed", name))
+		}
+		return true
+	})
+}
+
+func (o *Orchestrator) handleJobsRequest(w io.Writer, req dmnsocket.Request, peer *auth.Peer) error {
+	switch req.Action {
+	case "jobs":
+		return jobs.SendJobsResponse(w, o.jobs.List(), nil)
+	case "cancel":
+		reason := "cancelled"
+		if peer != nil {
+			reason += " by " + peer.String()
+		}
+		if err := o.cancelJob(req.Job, reason); err != nil {
+			return jobs.SendJobsResponse(w, nil, err)
+		}
+	}
+	job, err := o.jobs.Get(req.Job)
+	if err != nil {
+		return jobs.SendJobsResponse(w, nil, err)
+	}
+	return jobs.SendJobsResponse(w, []jobs.Job{job}, nil)
+}
@@ -0,0 +1,191 @@
+package orchestrator
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/metrics"
+)
+
+// metricActions are the socket actions counted under their own name, other
+// actions are counted as undefined to keep the number of series bounded.
+var metricActions = map[string]bool{
+	"run": true, "stop": true, "restart": true, "scale": true,
+	"logs": true, "plugins": true, "status": true, "reload": true, "audit": true,
+	"jobs": true, "job": true, "cancel": true, "plan": true,
+	"pipeline_run": true, "pipeline_resume": true, "pipeline_status": true,
+}
+
+type orchestratorMetrics struct {
+	requests       *metrics.HistogramVec
+	requestErrors  *metrics.CounterVec
+	dependencyWait *metrics.HistogramVec
+}
+
+func newOrchestratorMetrics() *orchestratorMetrics {
+	return &orchestratorMetrics{
+		requests:       metrics.NewHistogramVec("action", metrics.DURATION_BUCKETS),
+		requestErrors:  metrics.NewCounterVec("action"),
+		dependencyWait: metrics.NewHistogramVec("worker", metrics.DURATION_BUCKETS),
+	}
+}
+
+func (m *orchestratorMetrics) observeRequest(action string, duration time.Duration, err error) {
+	if !metricActions[action] {
+		action = "undefined"
+	}
+	m.requests.Observe(action, duration.Seconds())
+	if err != nil {
+		m.requestErrors.Inc(action)
+	}
+}
+
+func (o *Orchestrator) serveMetrics(address string) error {
+	return o.httpServer(address, o.metricsHandler()).ListenAndServe()
+}
+
+func (o *Orchestrator) metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		if err := o.writeMetrics(metrics.NewWriter(&buf)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+	return mux
+}
+
+// writeMetrics writes the state of every worker and the request metrics.
+func (o *Orchestrator) writeMetrics(w *metrics.Writer) error {
+	workersStatus := o.status.Get()
+	names := make([]string, 0, len(workersStatus))
+	for name := range workersStatus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Family("anthill_worker_state", "gauge", "State of the worker, 1 for the current state.")
+	for i := 0; i < len(names); i++ {
+		s := workersStatus[names[i]]
+		w.Sample("anthill_worker_state", boolValue(s.Active), "worker", names[i], "state", "running")
+		w.Sample("anthill_worker_state", boolValue(!s.Active && s.Done), "worker", names[i], "state", "done")
+		w.Sample("anthill_worker_state", boolValue(!s.Active && s.Failed), "worker", names[i], "state", "failed")
+		w.Sample("anthill_worker_state", boolValue(!s.Active && !s.Done && !s.Failed), "worker", names[i], "state", "stopped")
+	}
+	w.Family("anthill_worker_uptime_seconds", "gauge", "Seconds since the worker was started, 0 if it is not running.")
+	for i := 0; i < len(names); i++ {
+		s := workersStatus[names[i]]
+		uptime := 0.0
+		if s.Active {
+			uptime = time.Since(s.UpDate).Seconds()
+		}
+		w.Sample("anthill_worker_uptime_seconds", uptime, "worker", names[i])
+	}
+
+	o.processesMu.Lock()
+	processes := make(map[string]processMetrics, len(o.processes))
+	for name, p := range o.processes {
+		processes[name] = processMetrics{stats: p.Stats(), lineCounts: o.streams[name].LineCounts()}
+	}
+	// The parallel slots of a job are reported as workers of their own, their log
+	// lines are counted with the job.
+	processNames := slices.Clone(names)
+	for name, run := range o.jobRuns {
+		for i := 0; i < len(run.slots); i++ {
+			slotName := dmnworker.SlotName(name, i+1)
+			processes[slotName] = processMetrics{stats: run.slots[i].Stats()}
+			processNames = append(processNames, slotName)
+		}
+	}
+	o.processesMu.Unlock()
+	sort.Strings(processNames)
+	names = processNames
+
+	w.Family("anthill_worker_restarts_total", "counter", "Number of times the worker was started again after its first run.")
+	for i := 0; i < len(names); i++ {
+		restarts := 0
+		if p, ok := processes[names[i]]; ok && p.stats.Runs > 1 {
+			restarts = p.stats.Runs - 1
+		}
+		w.Sample("anthill_worker_restarts_total", float64(restarts), "worker", names[i])
+	}
+	w.Family("anthill_worker_last_exit_code", "gauge", "Exit code of the last run of the worker, -1 if it was killed by a signal.")
+	for i := 0; i < len(names); i++ {
+		if p, ok := processes[names[i]]; ok && p.stats.Exited {
+			w.Sample("anthill_worker_last_exit_code", float64(p.stats.ExitCode), "worker", names[i])
+		}
+	}
+	// /proc is read once per scrape, not once per worker.
+	var tree metrics.ProcessTree
+	procStats := make(map[string]*metrics.ProcStats, len(processes))
+	for i := 0; i < len(names); i++ {
+		p, ok := processes[names[i]]
+		if !ok || p.stats.Pid == 0 {
+			continue
+		}
+		if tree == nil {
+			tree = metrics.ReadProcessTree()
+		}
+		stats, err := metrics.ReadProc(p.stats.Pid, tree)
+		if err != nil {
+			log.Printf("read process of %s: %s\n", names[i], err)
+			continue
+		}
+		procStats[names[i]] = stats
+	}
+	w.Family("anthill_worker_cpu_seconds_total", "counter", "CPU time of the current run of the worker and its child processes.")
+	for i := 0; i < len(names); i++ {
+		if stats, ok := procStats[names[i]]; ok {
+			w.Sample("anthill_worker_cpu_seconds_total", stats.CPUSeconds, "worker", names[i])
+		}
+	}
+	w.Family("anthill_worker_resident_memory_bytes", "gauge", "Resident memory of the worker and its child processes.")
+	for i := 0; i < len(names); i++ {
+		if stats, ok := procStats[names[i]]; ok {
+			w.Sample("anthill_worker_resident_memory_bytes", float64(stats.RSSBytes), "worker", names[i])
+		}
+	}
+	w.Family("anthill_worker_log_lines_total", "counter", "Number of log lines of the worker per stream.")
+	for i := 0; i < len(names); i++ {
+		p, ok := processes[names[i]]
+		if !ok {
+			continue
+		}
+		streams := make([]string, 0, len(p.lineCounts))
+		for stream := range p.lineCounts {
+			streams = append(streams, stream)
+		}
+		sort.Strings(streams)
+		for _, stream := range streams {
+			w.Sample("anthill_worker_log_lines_total", float64(p.lineCounts[stream]), "worker", names[i], "stream", stream)
+		}
+	}
+
+	w.Family("anthill_worker_dependency_wait_seconds", "histogram", "Time a worker waited for its dependencies before it was started.")
+	o.metrics.dependencyWait.Write(w, "anthill_worker_dependency_wait_seconds")
+	w.Family("anthill_request_duration_seconds", "histogram", "Duration of the requests to the orchestrator socket per action.")
+	o.metrics.requests.Write(w, "anthill_request_duration_seconds")
+	w.Family("anthill_request_errors_total", "counter", "Number of requests per action that failed to be handled.")
+	o.metrics.requestErrors.Write(w, "anthill_request_errors_total")
+	return w.Err()
+}
+
+type processMetrics struct {
+	stats      dmnworker.ProcessStats
+	lineCounts map[string]int64
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
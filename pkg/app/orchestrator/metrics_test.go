@@ -0,0 +1,107 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+)
+
+type fakeProcess struct {
+	dmnworker.AWorkerProcess
+	stats dmnworker.ProcessStats
+}
+
+func (p *fakeProcess) Stats() dmnworker.ProcessStats {
+	return p.stats
+}
+
+type fakeStreamer struct {
+	dmnprocess.Streamer
+	lineCounts map[string]int64
+}
+
+func (s *fakeStreamer) LineCounts() map[string]int64 {
+	return s.lineCounts
+}
+
+func TestMetricsScrape(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	o := NewOrchestartor()
+	o.workersConfig = &parsecnf.WorkersConfig{Workers: []dmnworker.WorkerConfig{{Name: "web"}, {Name: "idle"}, {Name: "crashed"}}}
+	o.initStatus()
+	if err := o.status.SetRunning("web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.status.SetFailed("crashed", 1, "exit status 1"); err != nil {
+		t.Fatal(err)
+	}
+	o.processes["web"] = &fakeProcess{stats: dmnworker.ProcessStats{Pid: cmd.Process.Pid, Runs: 3}}
+	o.streams["web"] = &fakeStreamer{lineCounts: map[string]int64{"stdout": 7, "stderr": 2}}
+	o.metrics.observeRequest("status", 20*time.Millisecond, nil)
+	o.metrics.observeRequest("run", 20*time.Millisecond, errors.New("failed"))
+
+	server := httptest.NewServer(o.metricsHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Fatalf("content type = %q", contentType)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(body)
+
+	for _, want := range []string{
+		"# TYPE anthill_worker_state gauge",
+		`anthill_worker_state{worker="web",state="running"} 1`,
+		`anthill_worker_state{worker="idle",state="stopped"} 1`,
+		`anthill_worker_state{worker="crashed",state="failed"} 1`,
+		`anthill_worker_state{worker="crashed",state="stopped"} 0`,
+		`anthill_worker_restarts_total{worker="web"} 2`,
+		`anthill_worker_log_lines_total{worker="web",stream="stdout"} 7`,
+		`anthill_worker_log_lines_total{worker="web",stream="stderr"} 2`,
+		`anthill_request_duration_seconds_count{action="status"} 1`,
+		`anthill_request_errors_total{action="run"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+	for _, family := range []string{"anthill_worker_cpu_seconds_total", "anthill_worker_resident_memory_bytes"} {
+		if !strings.Contains(text, fmt.Sprintf(`%s{worker="web"} `, family)) {
+			t.Errorf("metrics do not contain %s of web", family)
+		}
+		if strings.Contains(text, fmt.Sprintf(`%s{worker="idle"}`, family)) {
+			t.Errorf("metrics contain %s of the stopped worker", family)
+		}
+	}
+	if t.Failed() {
+		t.Log(text)
+	}
+}
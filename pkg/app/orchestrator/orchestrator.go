@@ -1,44 +1,84 @@
 package orchestrator
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"slices"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/uwine4850/anthill/internal/pathutils"
 	"github.com/uwine4850/anthill/pkg/config"
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
 	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
 	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/audit"
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+	"github.com/uwine4850/anthill/pkg/infra/jobs"
+	"github.com/uwine4850/anthill/pkg/infra/logsink"
 	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+	"github.com/uwine4850/anthill/pkg/infra/pipeline"
+	"github.com/uwine4850/anthill/pkg/infra/plug"
 	"github.com/uwine4850/anthill/pkg/infra/process"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
 	"github.com/uwine4850/anthill/pkg/infra/status"
 	"github.com/uwine4850/anthill/pkg/infra/worker"
 )
 
 type afterWorker struct {
-	Conn      net.Conn
+	Name      string
 	PluginAnt dmnworker.PluginAnt
-	Request   dmnsocket.Request
+	job       int
+	deadline  time.Time
+	since     time.Time
 }
 
 type Orchestrator struct {
-	currentAnts          map[string]dmnworker.PluginAnt
-	workersConfig        *parsecnf.WorkersConfig
-	status               status.Status
-	antWorkerProcess     dmnworker.AWorkerProcess
+	mu               sync.RWMutex
+	config           *parsecnf.OrchestratorConfig
+	auth             *auth.Authorizer
+	audit            *audit.Log
+	pipelines        *pipeline.History
+	currentAnts      map[string]dmnworker.PluginAnt
+	workersConfig    *parsecnf.WorkersConfig
+	plugins          []dmnworker.PluginInfo
+	status           status.Status
+	antWorkerProcess dmnworker.AWorkerProcess
+	processes        map[string]dmnworker.AWorkerProcess
+	streams          map[string]dmnprocess.Streamer
+	jobRuns          map[string]*jobRun
+	processesMu      sync.Mutex
+	jobs             *jobs.Jobs
+	// startAfterWorkerAnts holds the pending starts by their job ID.
 	startAfterWorkerAnts sync.Map
+	metrics              *orchestratorMetrics
+	connections          chan struct{}
+	// replicaTemplates holds the ant the replicas of a scaled worker are created from.
+	replicaTemplates map[string]dmnworker.PluginAnt
 }
 
 func NewOrchestartor() Orchestrator {
 	return Orchestrator{
+		config:               parsecnf.DefaultOrchestratorConfig(),
 		currentAnts:          make(map[string]dmnworker.PluginAnt, 0),
+		replicaTemplates:     make(map[string]dmnworker.PluginAnt),
 		status:               status.NewStatus(),
 		antWorkerProcess:     &process.AntWorkerProcess{},
+		processes:            make(map[string]dmnworker.AWorkerProcess),
+		streams:              make(map[string]dmnprocess.Streamer),
+		jobRuns:              make(map[string]*jobRun),
+		jobs:                 jobs.NewJobs(),
 		startAfterWorkerAnts: sync.Map{},
+		metrics:              newOrchestratorMetrics(),
 	}
 }
 
@@ -47,26 +87,64 @@ func (o *Orchestrator) initStatus() {
 }
 
 func (o *Orchestrator) CollectAnts() error {
-	plugs, err := parsecnf.ParsePlugins("plugins.yaml")
+	orchestratorConfig, err := parsecnf.ParseOrchestrator("anthill.yaml")
 	if err != nil {
 		return err
 	}
-	pluginAnts, err := worker.ExtractPluginAntsFromPlugins(*plugs)
+	o.config = orchestratorConfig
+	if orchestratorConfig.Auth != nil {
+		authorizer, err := auth.NewAuthorizer(orchestratorConfig.Auth)
+		if err != nil {
+			return err
+		}
+		o.auth = authorizer
+	}
+	if !orchestratorConfig.Audit.Disabled {
+		keyFile := orchestratorConfig.Audit.KeyFile
+		if keyFile == "" {
+			keyFile = orchestratorConfig.Audit.Path + ".key"
+		}
+		auditLog, err := audit.Open(orchestratorConfig.Audit.Path, keyFile)
+		if err != nil {
+			return err
+		}
+		o.audit = auditLog
+	}
+	history, err := pipeline.OpenHistory(orchestratorConfig.Pipelines.History)
 	if err != nil {
 		return err
 	}
-	workersc, err := parsecnf.ParseWorkers("workers.yaml")
+	o.pipelines = history
+
+	currentAnts, workersc, pluginsInfo, err := loadAnts()
 	if err != nil {
 		return err
 	}
+	o.plugins = pluginsInfo
 	o.workersConfig = workersc
+	o.currentAnts = currentAnts
+	return nil
+}
 
+// loadAnts reads the plugins and workers configs and returns the ants of all worker instances.
+func loadAnts() (map[string]dmnworker.PluginAnt, *parsecnf.WorkersConfig, []dmnworker.PluginInfo, error) {
+	plugs, err := parsecnf.ParsePlugins("plugins.yaml")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pluginAnts, pluginsInfo, err := worker.ExtractPluginAntsFromPlugins(*plugs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	workersc, err := parsecnf.ParseWorkers("workers.yaml")
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	currentAnts, err := worker.CurrentAnts(workersc, pluginAnts)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
-	o.currentAnts = currentAnts
-	return nil
+	return currentAnts, workersc, pluginsInfo, nil
 }
 
 func (o *Orchestrator) validateAnthillSocketPath() error {
@@ -83,8 +161,10 @@ func (o *Orchestrator) Listen() error {
 		return err
 	}
 	o.initStatus()
+	o.openStreams()
+	o.connections = make(chan struct{}, o.config.Limits.MaxConnections)
 
-	listener, err := net.Listen("unix", config.ANTHILL_SOCKET_PATH)
+	listener, err := auth.ListenSocket(config.ANTHILL_SOCKET_PATH, o.config.Socket)
 	if err != nil {
 		return err
 	}
@@ -93,104 +173,420 @@ func (o *Orchestrator) Listen() error {
 	fmt.Println("Orchestrator online.")
 
 	go o.runDependentWorkers()
+	if o.config != nil && o.config.Metrics.Address != "" {
+		go func() {
+			if err := o.serveMetrics(o.config.Metrics.Address); err != nil {
+				log.Printf("metrics listener error: %s\n", err)
+			}
+		}()
+	}
+	if o.config != nil && o.config.API.Address != "" {
+		go func() {
+			if err := o.serveAPI(o.config.API.Address); err != nil {
+				log.Printf("api listener error: %s\n", err)
+			}
+		}()
+	}
+	if o.config != nil && o.config.TLS.Address != "" {
+		tlsListener, err := listenTLS(o.config.TLS)
+		if err != nil {
+			return err
+		}
+		defer tlsListener.Close()
+		go o.serve(tlsListener)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+	o.serve(listener)
+	o.shutdown()
+	return nil
+}
 
+// shutdown closes the streams of all workers, so log files and sinks are flushed
+// before the orchestrator exits.
+func (o *Orchestrator) shutdown() {
+	o.processesMu.Lock()
+	for name, streamer := range o.streams {
+		if err := streamer.Close(); err != nil {
+			log.Printf("close stream of %s: %s\n", name, err)
+		}
+	}
+	o.processesMu.Unlock()
+	logsink.CloseAll()
+}
+
+// serve handles the connections of the listener until it is closed. Connections
+// over the limit are answered with an error and closed.
+func (o *Orchestrator) serve(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			continue
-		}
-		go func() {
-			var req dmnsocket.Request
-			decoder := json.NewDecoder(conn)
-			if err := decoder.Decode(&req); err != nil {
-				log.Printf("decode error: %s\n", err)
-			}
-			if len(o.currentAnts[req.Name].After) != 0 {
-				o.startAfterWorkerAnts.Store(conn, afterWorker{
-					Conn:      conn,
-					PluginAnt: o.currentAnts[req.Name],
-					Request:   req,
-				})
+			if errors.Is(err, net.ErrClosed) {
 				return
 			}
-			if err := o.handleConnection(conn, req); err != nil {
-				log.Printf("handle connection error: %s\n", err)
-			}
-		}()
+			continue
+		}
+		select {
+		case o.connections <- struct{}{}:
+			go func() {
+				defer func() { <-o.connections }()
+				o.handleConnection(conn)
+			}()
+		default:
+			go func() {
+				defer conn.Close()
+				w := &deadlineWriter{conn: conn, timeout: o.config.Limits.WriteTimeout}
+				sendResponse(w, nil, fmt.Errorf("too many connections, at most %d", o.config.Limits.MaxConnections))
+			}()
+		}
 	}
 }
 
-func (o *Orchestrator) handleConnection(conn net.Conn, req dmnsocket.Request) error {
+func (o *Orchestrator) handleConnection(conn net.Conn) {
 	defer conn.Close()
-	p := o.antWorkerProcess.New(&o.currentAnts, req.Name)
-	p.OnDone(func() {
-		if err := o.status.SetDone(req.Name); err != nil {
-			log.Println(err)
+	// The client sends nothing after the request, a read returns once it disconnects.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limits := o.config.Limits
+	w := &deadlineWriter{conn: conn, timeout: limits.WriteTimeout}
+	var req dmnsocket.Request
+	conn.SetReadDeadline(time.Now().Add(limits.ReadTimeout))
+	request := &io.LimitedReader{R: conn, N: limits.MaxRequestBytes}
+	decoder := json.NewDecoder(request)
+	if err := decoder.Decode(&req); err != nil {
+		if request.N <= 0 {
+			err = fmt.Errorf("request exceeds %d bytes", limits.MaxRequestBytes)
+			sendResponse(w, nil, err)
 		}
-	})
+		log.Printf("decode error: %s\n", err)
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	peer, peerErr := connPeer(conn)
+	if err := o.authorizeConn(peer, peerErr, req.Action); err != nil {
+		o.recordAudit(time.Now(), peer, req, "denied: "+err.Error())
+		if sendErr := sendResponse(w, nil, err); sendErr != nil {
+			log.Println(sendErr)
+		}
+		return
+	}
+	go func() {
+		io.Copy(io.Discard, conn)
+		cancel()
+	}()
+	if err := o.handleRequest(ctx, w, req, peer); err != nil {
+		log.Printf("handle connection error: %s\n", err)
+	}
+}
+
+// authorizeConn checks the role of the socket peer if access control is enabled.
+func (o *Orchestrator) authorizeConn(peer *auth.Peer, peerErr error, action string) error {
+	if o.auth == nil {
+		return nil
+	}
+	if peerErr != nil {
+		return peerErr
+	}
+	return auth.Authorize(o.auth.PeerRole(peer), action)
+}
+
+// connPeer identifies the client of the connection. Without credentials the
+// peer is unknown, which only matters if access control is enabled.
+func connPeer(conn net.Conn) (*auth.Peer, error) {
+	var peer *auth.Peer
+	var err error
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		peer, err = auth.TLSPeer(tlsConn)
+	} else {
+		peer, err = auth.PeerCredentials(conn)
+	}
+	if err != nil {
+		return &auth.Peer{Address: conn.RemoteAddr().String()}, err
+	}
+	return peer, nil
+}
 
+// handleRequest performs the action of the request and writes the response to w.
+// It is shared by the socket and the HTTP API, so both behave the same.
+// The context is done when the client disconnects. Every request is recorded in the audit log.
+func (o *Orchestrator) handleRequest(ctx context.Context, w io.Writer, req dmnsocket.Request, peer *auth.Peer) (err error) {
+	conn := &responseRecorder{w: w}
+	defer func(start time.Time) {
+		o.metrics.observeRequest(req.Action, time.Since(start), err)
+		o.recordAudit(start, peer, req, conn.outcome(err))
+	}(time.Now())
 	switch req.Action {
 	case "run":
-		if err := p.Run(); err != nil {
-			return err
-		}
-		if err := o.status.SetRunning(req.Name); err != nil {
-			return err
+		names, err := o.resolveTargets(req)
+		if err != nil {
+			return sendResponse(conn, nil, err)
 		}
+		results, err := o.startWorkers(names, req.Deadline)
+		return sendResponse(conn, results, err)
 	case "stop":
-		if err := p.Stop(); err != nil {
-			return err
+		names, err := o.resolveTargets(req)
+		if err != nil {
+			return sendResponse(conn, nil, err)
 		}
-		if err := o.status.SetStopped(req.Name); err != nil {
-			return err
+		results, err := o.forEachWorker(names, o.stopWorker)
+		return sendResponse(conn, results, err)
+	case "restart":
+		names, err := o.resolveTargets(req)
+		if err != nil {
+			return sendResponse(conn, nil, err)
+		}
+		results, err := o.rollingRestart(names, req.Parallel)
+		return sendResponse(conn, results, err)
+	case "scale":
+		results, err := o.scale(req.Name, req.Replicas, req.Deadline)
+		return sendResponse(conn, results, err)
+	case "logs":
+		if req.Follow {
+			return o.followLogs(ctx, conn, req)
+		}
+		names, err := o.resolveTargets(req)
+		if err != nil {
+			return sendResponse(conn, nil, err)
+		}
+		return sendResponse(conn, o.logTargets(names), nil)
+	case "plan":
+		stages, err := o.plan()
+		resp := dmnsocket.Response{Stages: stages}
+		if err != nil {
+			resp.Error = err.Error()
 		}
+		return socket.SendRequest(conn, &resp)
+	case "reload":
+		results, err := o.reload()
+		return sendResponse(conn, results, err)
+	case "audit":
+		return audit.SendAuditResponse(conn, o.audit, req.Since)
+	case "jobs", "job", "cancel":
+		return o.handleJobsRequest(conn, req, peer)
+	case "pipeline_run", "pipeline_resume", "pipeline_status":
+		return o.handlePipelineRequest(conn, req)
+	case "plugins":
+		return plug.SendPluginsResponse(conn, o.pluginsInfo())
 	case "status":
-		if req.Name == "" {
+		if req.Name == "" && req.Selector == "" {
 			if err := status.SendResponse(conn, o.status); err != nil {
 				return err
 			}
-		} else {
-			if err := status.SendWorkerResponse(conn, req.Name, o.status); err != nil {
-				return err
-			}
+			return nil
+		}
+		names, err := o.statusTargets(req)
+		if err != nil {
+			return socket.SendRequest(conn, &status.StatusResponse{Error: err.Error()})
+		}
+		if err := status.SendWorkersResponse(conn, names, o.status); err != nil {
+			return err
 		}
 	default:
-		return fmt.Errorf("undefined action <%s>", req.Action)
+		err := fmt.Errorf("undefined action <%s>", req.Action)
+		if sendErr := sendResponse(conn, nil, err); sendErr != nil {
+			log.Println(sendErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (o *Orchestrator) workerProcess(name string) dmnworker.AWorkerProcess {
+	o.processesMu.Lock()
+	defer o.processesMu.Unlock()
+	if p, ok := o.processes[name]; ok {
+		return p
+	}
+	pluginAnt := o.pluginAnt(name)
+	streamer := process.NewAntWorkerStreamer(name, pluginAnt)
+	if err := streamer.Stream(); err != nil {
+		log.Printf("stream of %s: %s\n", name, err)
+	}
+	o.streams[name] = streamer
+	p := o.antWorkerProcess.New(pluginAnt, name, streamer)
+	p.OnDone(func(err error) {
+		if o.pluginAnt(name).Kind == dmnworker.KIND_JOB {
+			// The status of a job is set by runJob once all of its runs are done.
+			return
+		}
+		if err != nil {
+			err = o.status.SetFailed(name, p.Stats().ExitCode, err.Error())
+		} else {
+			err = o.status.SetDone(name)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	})
+	p.OnReady(func() {
+		o.setReady(name)
+	})
+	p.OnReload(func() {
+		// The restarted service is not ready until it notifies or its probe passes again.
+		if err := o.status.SetRunning(name); err != nil {
+			log.Println(err)
+			return
+		}
+		o.watchReadiness(name, o.pluginAnt(name), p)
+	})
+	o.processes[name] = p
+	return p
+}
+
+// openStreams creates the processes of all workers, so their log streams can be
+// followed before the first run.
+func (o *Orchestrator) openStreams() {
+	o.mu.RLock()
+	names := make([]string, 0, len(o.currentAnts))
+	for name := range o.currentAnts {
+		names = append(names, name)
+	}
+	o.mu.RUnlock()
+	for i := 0; i < len(names); i++ {
+		o.workerProcess(names[i])
+	}
+}
+
+func (o *Orchestrator) runWorker(name string) error {
+	return o.runWorkerWith(name, workerOutputs)
+}
+
+// runWorkerWith runs the worker with the outputs it references looked up by lookup.
+func (o *Orchestrator) runWorkerWith(name string, lookup func(step string) (map[string]string, error)) error {
+	pluginAnt, err := o.prepareRun(name, lookup, false)
+	if err != nil {
+		return err
+	}
+	if pluginAnt.Kind == dmnworker.KIND_JOB {
+		return o.runJob(name, pluginAnt)
 	}
+	p := o.workerProcess(name)
+	p.SetPluginAnt(pluginAnt)
+	if err := p.Run(); err != nil {
+		return err
+	}
+	if err := o.status.SetRunning(name); err != nil {
+		return err
+	}
+	o.watchReadiness(name, pluginAnt, p)
 	return nil
 }
 
+func (o *Orchestrator) stopWorker(name string) error {
+	if !o.stopJob(name) {
+		if err := o.workerProcess(name).Stop(); err != nil {
+			return err
+		}
+	}
+	return o.status.SetStopped(name)
+}
+
+// deadlineWriter bounds every write to a client, so a client that stops reading
+// cannot block the orchestrator.
+type deadlineWriter struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (w *deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+	return w.conn.Write(p)
+}
+
+func sendResponse(conn io.Writer, results []dmnsocket.WorkerResult, err error) error {
+	resp := dmnsocket.Response{Results: results}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return socket.SendRequest(conn, &resp)
+}
+
+func (o *Orchestrator) pluginAnt(name string) dmnworker.PluginAnt {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.currentAnts[name]
+}
+
+// startWorker runs the worker if it has no dependencies. Otherwise it returns the ID
+// of a pending job that runs the worker once its dependencies are done, or is
+// cancelled at the deadline.
+func (o *Orchestrator) startWorker(name string, deadline time.Time) (int, error) {
+	pluginAnt := o.pluginAnt(name)
+	if len(pluginAnt.After) == 0 && len(pluginAnt.AfterReady) == 0 {
+		return 0, o.runWorker(name)
+	}
+	job := o.jobs.Add(name, slices.Concat(pluginAnt.After, pluginAnt.AfterReady), deadline)
+	o.startAfterWorkerAnts.Store(job.ID, &afterWorker{
+		Name:      name,
+		PluginAnt: pluginAnt,
+		job:       job.ID,
+		deadline:  deadline,
+		since:     job.Created,
+	})
+	return job.ID, nil
+}
+
+// dependenciesDone reports whether every instance of the dependencies of the worker
+// is done, or ready for after_ready, and returns the name of a failed instance. A
+// dependency scaled to no replicas is not done until it is scaled up again.
+func (o *Orchestrator) dependenciesDone(pluginAnt dmnworker.PluginAnt, workersStatus map[string]status.WorkerStatusData) (bool, string) {
+	dependencies := slices.Concat(pluginAnt.After, pluginAnt.AfterReady)
+	for i := 0; i < len(dependencies); i++ {
+		// A worker that is done has been ready, so it also satisfies after_ready.
+		waitReady := i >= len(pluginAnt.After)
+		names := o.instanceNames(dependencies[i])
+		if len(names) == 0 {
+			return false, ""
+		}
+		for _, name := range names {
+			s, ok := workersStatus[name]
+			if !ok {
+				log.Println(fmt.Errorf("running worker <%s> not exists", name))
+			}
+			if s.Failed {
+				return false, name
+			}
+			if !s.Done && !(waitReady && s.Ready) {
+				return false, ""
+			}
+		}
+	}
+	return true, ""
+}
+
 func (o *Orchestrator) runDependentWorkers() {
 	for {
-		mustRunWorkers := []afterWorker{}
+		workersStatus := o.status.Get()
 		o.startAfterWorkerAnts.Range(func(key, value any) bool {
-			afterWorker := value.(afterWorker)
-			isAllDone := false
-			for i := 0; i < len(afterWorker.PluginAnt.After); i++ {
-				s, ok := o.status.Get()[afterWorker.PluginAnt.After[i]]
-				if !ok {
-					log.Println(fmt.Errorf("running worker <%s> not exists", afterWorker.PluginAnt.After[i]))
-				}
-				if s.Done {
-					isAllDone = true
-				} else {
-					isAllDone = false
-				}
+			after := value.(*afterWorker)
+			if !after.deadline.IsZero() && time.Now().After(after.deadline) {
+				o.cancelJob(after.job, "deadline exceeded")
+				return true
 			}
-			if isAllDone {
-				mustRunWorkers = append(mustRunWorkers, afterWorker)
-				return false
+			isAllDone, failed := o.dependenciesDone(after.PluginAnt, workersStatus)
+			if failed != "" {
+				o.cancelJob(after.job, fmt.Sprintf("worker <%s> failed", failed))
+				return true
 			}
-			return true
-		})
-		for i := 0; i < len(mustRunWorkers); i++ {
+			if !isAllDone {
+				return true
+			}
+			// A cancelled start is already removed by cancelJob.
+			if _, ok := o.startAfterWorkerAnts.LoadAndDelete(key); !ok {
+				return true
+			}
+			o.metrics.dependencyWait.Observe(after.Name, time.Since(after.since).Seconds())
 			go func() {
-				if err := o.handleConnection(mustRunWorkers[i].Conn, mustRunWorkers[i].Request); err != nil {
-					log.Printf("handle connection error: %s", err)
-				}
+				o.jobs.Finish(after.job, o.runWorker(after.Name))
 			}()
-			o.startAfterWorkerAnts.Delete(mustRunWorkers[i].Conn)
-		}
+			return true
+		})
 		time.Sleep(500 * time.Millisecond)
 	}
 }
@@ -0,0 +1,66 @@
+package orchestrator
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/outputs"
+)
+
+// workerOutputs looks up the outputs of a step outside of a pipeline, where the
+// name of the step is the name of the worker.
+func workerOutputs(step string) (map[string]string, error) {
+	return outputs.Read(step)
+}
+
+// resolveAnt returns the ant of the worker with the output references in its args
+// and env replaced by the outputs of the steps they name.
+func (o *Orchestrator) resolveAnt(name string, lookup func(step string) (map[string]string, error)) (dmnworker.PluginAnt, error) {
+	pluginAnt := o.pluginAnt(name)
+	args := make([]string, len(pluginAnt.Args))
+	for i := 0; i < len(pluginAnt.Args); i++ {
+		arg, err := outputs.Resolve(pluginAnt.Args[i], lookup)
+		if err != nil {
+			return pluginAnt, fmt.Errorf("worker <%s> args: %w", name, err)
+		}
+		args[i] = arg
+	}
+	pluginAnt.Args = args
+	if pluginAnt.Env != nil {
+		env := make(map[string]string, len(pluginAnt.Env))
+		for _, key := range slices.Sorted(maps.Keys(pluginAnt.Env)) {
+			value, err := outputs.Resolve(pluginAnt.Env[key], lookup)
+			if err != nil {
+				return pluginAnt, fmt.Errorf("worker <%s> env %s: %w", name, key, err)
+			}
+			env[key] = value
+		}
+		pluginAnt.Env = env
+	}
+	return pluginAnt, nil
+}
+
+// prepareRun resolves the ant of the worker for its next run and removes the outputs
+// of its previous run, including those of the parallel slots of a job. The outputs of
+// a running worker are kept unless it is about to be restarted.
+func (o *Orchestrator) prepareRun(name string, lookup func(step string) (map[string]string, error), restart bool) (dmnworker.PluginAnt, error) {
+	pluginAnt, err := o.resolveAnt(name, lookup)
+	if err != nil {
+		return pluginAnt, err
+	}
+	if !restart && o.status.Get()[name].Active {
+		return pluginAnt, nil
+	}
+	slots := 1
+	if pluginAnt.Kind == dmnworker.KIND_JOB {
+		slots = max(pluginAnt.Job.Parallelism, 1)
+	}
+	for i := 0; i < slots; i++ {
+		if err := outputs.Reset(dmnworker.SlotName(name, i)); err != nil {
+			return pluginAnt, err
+		}
+	}
+	return pluginAnt, nil
+}
@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/outputs"
+	"github.com/uwine4850/anthill/pkg/infra/pipeline"
+)
+
+type stepResult struct {
+	step     int
+	exitCode int
+	err      error
+}
+
+func (o *Orchestrator) handlePipelineRequest(w io.Writer, req dmnsocket.Request) error {
+	var run pipeline.Run
+	var err error
+	switch {
+	case req.Action == "pipeline_run":
+		run, err = o.runPipeline(req.Name)
+	case req.Action == "pipeline_resume":
+		run, err = o.resumePipeline(req.Run, req.Step)
+	case req.Run != 0:
+		run, err = o.pipelines.Get(req.Run)
+	default:
+		if req.Name != "" {
+			if _, err := o.pipelineConfig(req.Name); err != nil {
+				return pipeline.SendPipelineResponse(w, nil, err)
+			}
+		}
+		return pipeline.SendPipelineResponse(w, o.pipelines.List(req.Name), nil)
+	}
+	if err != nil {
+		return pipeline.SendPipelineResponse(w, nil, err)
+	}
+	return pipeline.SendPipelineResponse(w, []pipeline.Run{run}, nil)
+}
+
+func (o *Orchestrator) pipelineConfig(name string) (dmnworker.PipelineConfig, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	for i := 0; i < len(o.workersConfig.Pipelines); i++ {
+		if o.workersConfig.Pipelines[i].Name == name {
+			return o.workersConfig.Pipelines[i], nil
+		}
+	}
+	return dmnworker.PipelineConfig{}, fmt.Errorf("pipeline <%s> not exists", name)
+}
+
+// runPipeline starts a run of the pipeline in the background and returns it.
+func (o *Orchestrator) runPipeline(name string) (pipeline.Run, error) {
+	pipelineConfig, err := o.pipelineConfig(name)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	run, err := o.pipelines.Add(pipeline.NewRun(pipelineConfig))
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	go o.executePipeline(run, pipelineConfig)
+	return run, nil
+}
+
+// resumePipeline starts a run that reruns the step from, the steps after it and
+// every step that did not succeed in the previous run. The other steps are reused.
+func (o *Orchestrator) resumePipeline(id int, from string) (pipeline.Run, error) {
+	previous, err := o.pipelines.Get(id)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	if previous.State == pipeline.STATE_RUNNING {
+		return pipeline.Run{}, fmt.Errorf("pipeline run <%d> is still running", id)
+	}
+	pipelineConfig, err := o.pipelineConfig(previous.Pipeline)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	if from == "" {
+		for i := 0; i < len(previous.Steps) && from == ""; i++ {
+			if previous.Steps[i].State == pipeline.STATE_FAILED || previous.Steps[i].State == pipeline.STATE_INTERRUPTED {
+				from = previous.Steps[i].Name
+			}
+		}
+		if from == "" {
+			return pipeline.Run{}, fmt.Errorf("pipeline run <%d> has no failed step, choose a step to resume from", id)
+		}
+	}
+
+	run := pipeline.NewRun(pipelineConfig)
+	if run.Step(from) < 0 {
+		return pipeline.Run{}, fmt.Errorf("pipeline <%s> has no step <%s>", previous.Pipeline, from)
+	}
+	rerun := downstreamSteps(pipelineConfig, from)
+	for i := 0; i < len(run.Steps); i++ {
+		step := &run.Steps[i]
+		j := previous.Step(step.Name)
+		if rerun[step.Name] || j < 0 || previous.Steps[j].State != pipeline.STATE_SUCCEEDED {
+			continue
+		}
+		*step = previous.Steps[j]
+		step.Reused = true
+	}
+	run.ResumedFrom = id
+	run, err = o.pipelines.Add(run)
+	if err != nil {
+		return pipeline.Run{}, err
+	}
+	go o.executePipeline(run, pipelineConfig)
+	return run, nil
+}
+
+// downstreamSteps returns the step and all steps that are directly or indirectly after it.
+func downstreamSteps(pipelineConfig dmnworker.PipelineConfig, from string) map[string]bool {
+	steps := map[string]bool{from: true}
+	for changed := true; changed; {
+		changed = false
+		for _, step := range pipelineConfig.Steps {
+			if steps[step.Name] {
+				continue
+			}
+			for _, after := range step.After {
+				if steps[after] {
+					steps[step.Name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return steps
+}
+
+// executePipeline runs every pending step once the steps it is after have succeeded.
+// After a failed step no more steps are started and the pending steps are skipped.
+func (o *Orchestrator) executePipeline(run pipeline.Run, pipelineConfig dmnworker.PipelineConfig) {
+	results := make(chan stepResult)
+	running := 0
+	failed := false
+	for {
+		for i := 0; i < len(run.Steps) && !failed; i++ {
+			if run.Steps[i].State != pipeline.STATE_PENDING || !stepReady(run, pipelineConfig.Steps[i]) {
+				continue
+			}
+			run.Steps[i].State = pipeline.STATE_RUNNING
+			run.Steps[i].Started = time.Now()
+			running++
+			go func(i int, worker string, lookup func(step string) (map[string]string, error)) {
+				exitCode, err := o.runStep(worker, lookup)
+				results <- stepResult{step: i, exitCode: exitCode, err: err}
+			}(i, run.Steps[i].Worker, stepOutputs(run))
+		}
+		o.updatePipelineRun(run)
+		if running == 0 {
+			break
+		}
+		result := <-results
+		running--
+		step := &run.Steps[result.step]
+		step.Duration = time.Since(step.Started)
+		step.ExitCode = result.exitCode
+		if result.err != nil {
+			step.State = pipeline.STATE_FAILED
+			step.Error = result.err.Error()
+			failed = true
+		} else {
+			step.State = pipeline.STATE_SUCCEEDED
+			values, err := outputs.Read(step.Worker)
+			if err != nil {
+				log.Printf("outputs of step %s: %s\n", step.Name, err)
+			}
+			step.Outputs = values
+		}
+	}
+
+	run.State = pipeline.STATE_SUCCEEDED
+	for i := 0; i < len(run.Steps); i++ {
+		switch run.Steps[i].State {
+		case pipeline.STATE_PENDING:
+			run.Steps[i].State = pipeline.STATE_SKIPPED
+			run.State = pipeline.STATE_FAILED
+		case pipeline.STATE_FAILED:
+			run.State = pipeline.STATE_FAILED
+		}
+	}
+	run.Finished = time.Now()
+	o.updatePipelineRun(run)
+}
+
+func stepReady(run pipeline.Run, step dmnworker.StepConfig) bool {
+	for i := 0; i < len(run.Steps); i++ {
+		if slices.Contains(step.After, run.Steps[i].Name) && run.Steps[i].State != pipeline.STATE_SUCCEEDED {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Orchestrator) updatePipelineRun(run pipeline.Run) {
+	if err := o.pipelines.Update(run); err != nil {
+		log.Printf("pipeline history error: %s\n", err)
+	}
+}
+
+// runStep runs the worker of a step without waiting for its own dependencies and
+// waits until it exits. The step succeeds if the worker is done.
+func (o *Orchestrator) runStep(worker string, lookup func(step string) (map[string]string, error)) (int, error) {
+	if err := o.runWorkerWith(worker, lookup); err != nil {
+		return -1, err
+	}
+	o.processesMu.Lock()
+	run, isJob := o.jobRuns[worker]
+	o.processesMu.Unlock()
+	if isJob {
+		<-run.done
+	} else {
+		<-o.workerProcess(worker).Done()
+	}
+	workerStatus := o.status.Get()[worker]
+	switch {
+	case workerStatus.Failed:
+		return workerStatus.ExitCode, errors.New(workerStatus.Error)
+	case !workerStatus.Done:
+		return -1, fmt.Errorf("worker <%s> was stopped", worker)
+	}
+	return 0, nil
+}
+
+// stepOutputs looks up the outputs recorded by the succeeded steps of the run, so a
+// resumed run uses the outputs of the steps it reuses. A name that is not a step of
+// the run is an error, the outputs of workers outside the pipeline are not read.
+func stepOutputs(run pipeline.Run) func(step string) (map[string]string, error) {
+	values := map[string]map[string]string{}
+	succeeded := map[string]bool{}
+	for i := 0; i < len(run.Steps); i++ {
+		values[run.Steps[i].Name] = run.Steps[i].Outputs
+		succeeded[run.Steps[i].Name] = run.Steps[i].State == pipeline.STATE_SUCCEEDED
+	}
+	return func(step string) (map[string]string, error) {
+		stepValues, ok := values[step]
+		if !ok {
+			return nil, fmt.Errorf("pipeline <%s> has no step <%s>", run.Pipeline, step)
+		}
+		if !succeeded[step] {
+			return nil, fmt.Errorf("step <%s> has not succeeded", step)
+		}
+		return stepValues, nil
+	}
+}
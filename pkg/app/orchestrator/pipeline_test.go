@@ -0,0 +1,34 @@
+package orchestrator
+
+import (
+	"testing"
+
+	"github.com/uwine4850/anthill/pkg/infra/pipeline"
+)
+
+func TestStepOutputs(t *testing.T) {
+	lookup := stepOutputs(pipeline.Run{
+		Pipeline: "release",
+		Steps: []pipeline.StepRun{
+			{Name: "build", Worker: "builder", State: pipeline.STATE_SUCCEEDED, Outputs: map[string]string{"image": "app:1"}},
+			{Name: "test", Worker: "tester", State: pipeline.STATE_FAILED},
+		},
+	})
+
+	values, err := lookup("build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["image"] != "app:1" {
+		t.Fatalf("outputs of build = %v", values)
+	}
+	if _, err := lookup("test"); err == nil {
+		t.Fatal("outputs of a failed step were returned")
+	}
+	// The name of a worker that is no step of the pipeline is rejected, even if it has outputs.
+	for _, step := range []string{"builder", "deploy"} {
+		if _, err := lookup(step); err == nil {
+			t.Fatalf("outputs of %s were returned", step)
+		}
+	}
+}
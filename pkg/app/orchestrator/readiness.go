@@ -0,0 +1,53 @@
+package orchestrator
+
+import (
+	"context"
+	"log"
+	"time"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/readiness"
+)
+
+// watchReadiness marks the started service as ready once it sent the ready notification
+// or its readiness probe passed. The probe stops when the run of the service ends.
+func (o *Orchestrator) watchReadiness(name string, pluginAnt dmnworker.PluginAnt, p dmnworker.AWorkerProcess) {
+	// A notification that came before the worker was set running is not in its status yet.
+	if p.Stats().Ready {
+		o.setReady(name)
+	}
+	if !pluginAnt.Readiness.IsSet() {
+		return
+	}
+	done := p.Done()
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-done:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		ticker := time.NewTicker(pluginAnt.Readiness.Interval)
+		defer ticker.Stop()
+		for {
+			if err := readiness.Probe(ctx, pluginAnt.Readiness); err == nil {
+				o.setReady(name)
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (o *Orchestrator) setReady(name string) {
+	if err := o.status.SetReady(name); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,78 @@
+package orchestrator
+
+import (
+	"sort"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// reload reads the configs again. Removed workers are stopped, new workers are
+// added without being started and the others run with the new config after
+// their next start. Log settings of existing workers keep their old values.
+func (o *Orchestrator) reload() ([]dmnsocket.WorkerResult, error) {
+	currentAnts, workersc, pluginsInfo, err := loadAnts()
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	previousAnts := o.currentAnts
+	added := []string{}
+	removed := []string{}
+	for name, pluginAnt := range currentAnts {
+		if _, ok := previousAnts[name]; !ok {
+			added = append(added, name)
+			o.status.Add(name, pluginAnt.Parent, pluginAnt.Replica)
+		}
+	}
+	for name := range previousAnts {
+		if _, ok := currentAnts[name]; !ok {
+			removed = append(removed, name)
+			// Removed workers stay known until they are stopped.
+			currentAnts[name] = previousAnts[name]
+		}
+	}
+	// The status kept for a worker scaled to no replicas goes with the scaling.
+	for i := 0; i < len(o.workersConfig.Workers); i++ {
+		w := o.workersConfig.Workers[i]
+		if _, ok := currentAnts[w.Name]; !ok && w.Scaled && w.Replicas == 0 {
+			o.status.Remove(w.Name)
+		}
+	}
+	o.currentAnts = currentAnts
+	o.replicaTemplates = make(map[string]dmnworker.PluginAnt)
+	o.workersConfig = workersc
+	o.plugins = pluginsInfo
+	o.mu.Unlock()
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	o.processesMu.Lock()
+	for name, p := range o.processes {
+		if pluginAnt, ok := currentAnts[name]; ok {
+			p.SetPluginAnt(pluginAnt)
+		}
+	}
+	o.processesMu.Unlock()
+
+	results := []dmnsocket.WorkerResult{}
+	for i := 0; i < len(added); i++ {
+		o.workerProcess(added[i])
+		results = append(results, dmnsocket.WorkerResult{Name: added[i]})
+	}
+	if len(removed) != 0 {
+		removedResults, _ := o.forEachWorker(removed, o.removeWorker)
+		results = append(results, removedResults...)
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+	return results, resultsError(results)
+}
+
+func (o *Orchestrator) pluginsInfo() []dmnworker.PluginInfo {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.plugins
+}
@@ -0,0 +1,105 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// rollingRestart restarts the workers in batches of parallel. Each batch must be running,
+// and ready if its workers report readiness, before the next one starts; the first
+// failure aborts the remaining batches.
+func (o *Orchestrator) rollingRestart(names []string, parallel int) ([]dmnsocket.WorkerResult, error) {
+	if parallel <= 0 {
+		parallel = 1
+	}
+	results := make([]dmnsocket.WorkerResult, len(names))
+	for i := 0; i < len(names); i++ {
+		results[i].Name = names[i]
+	}
+
+	var failed error
+	for start := 0; start < len(names); start += parallel {
+		end := min(start+parallel, len(names))
+		if failed != nil {
+			for i := start; i < end; i++ {
+				results[i].Error = "skipped: rolling restart aborted"
+			}
+			continue
+		}
+
+		var wg sync.WaitGroup
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := o.restartWorker(names[i]); err != nil {
+					results[i].Error = err.Error()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for i := start; i < end; i++ {
+			if results[i].Error != "" && failed == nil {
+				failed = fmt.Errorf("restart of worker <%s> failed: %s", names[i], results[i].Error)
+			}
+		}
+	}
+	return results, failed
+}
+
+func (o *Orchestrator) restartWorker(name string) error {
+	if o.pluginAnt(name).Kind == dmnworker.KIND_JOB {
+		o.stopJob(name)
+		return o.runWorker(name)
+	}
+	pluginAnt, err := o.prepareRun(name, workerOutputs, true)
+	if err != nil {
+		return err
+	}
+	p := o.workerProcess(name)
+	// A worker without a probe that was ready before signals its readiness itself.
+	waitReady := pluginAnt.Readiness.IsSet() || o.status.Get()[name].Ready
+	p.SetPluginAnt(pluginAnt)
+	if err := p.Restart(); err != nil {
+		return err
+	}
+	if err := o.status.SetRunning(name); err != nil {
+		return err
+	}
+	o.watchReadiness(name, pluginAnt, p)
+	select {
+	case <-p.Done():
+		return fmt.Errorf("worker exited within %s after restart", config.RESTART_SETTLE_TIME)
+	case <-time.After(config.RESTART_SETTLE_TIME):
+	}
+	if waitReady {
+		return o.waitReady(name, p.Done(), config.RESTART_READY_TIMEOUT)
+	}
+	return nil
+}
+
+// waitReady waits until the restarted worker is ready. It fails if the worker exits
+// or is not ready within timeout.
+func (o *Orchestrator) waitReady(name string, done <-chan struct{}, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(config.RESTART_READY_POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		if o.status.Get()[name].Ready {
+			return nil
+		}
+		select {
+		case <-done:
+			return fmt.Errorf("worker exited before it was ready after restart")
+		case <-deadline:
+			return fmt.Errorf("worker was not ready within %s after restart", timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package orchestrator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+)
+
+func newRestartOrchestrator(t *testing.T) *Orchestrator {
+	t.Helper()
+	o := NewOrchestartor()
+	o.workersConfig = &parsecnf.WorkersConfig{Workers: []dmnworker.WorkerConfig{{Name: "web"}}}
+	o.initStatus()
+	if err := o.status.SetRunning("web"); err != nil {
+		t.Fatal(err)
+	}
+	return &o
+}
+
+func TestWaitReady(t *testing.T) {
+	o := newRestartOrchestrator(t)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		o.setReady("web")
+	}()
+	if err := o.waitReady("web", make(chan struct{}), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitReadyTimeout(t *testing.T) {
+	o := newRestartOrchestrator(t)
+	err := o.waitReady("web", make(chan struct{}), 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Fatalf("err = %v, want a readiness timeout", err)
+	}
+}
+
+func TestWaitReadyExited(t *testing.T) {
+	o := newRestartOrchestrator(t)
+	done := make(chan struct{})
+	close(done)
+	err := o.waitReady("web", done, 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "exited") {
+		t.Fatalf("err = %v, want an exit error", err)
+	}
+}
@@ -0,0 +1,124 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+	"github.com/uwine4850/anthill/pkg/infra/worker"
+)
+
+// scale changes the number of replicas of the worker. A worker without replicas counts
+// as one, scaling it to another number replaces its instance by replicas. New replicas
+// are started, surplus replicas are stopped and removed starting from the highest index.
+func (o *Orchestrator) scale(name string, replicas int, deadline time.Time) ([]dmnsocket.WorkerResult, error) {
+	if replicas < 0 {
+		return nil, fmt.Errorf("worker <%s> cannot have a negative number of replicas", name)
+	}
+	added, removed, err := o.setReplicas(name, replicas)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []dmnsocket.WorkerResult{}
+	if len(added) != 0 {
+		addedResults, _ := o.startWorkers(added, deadline)
+		results = append(results, addedResults...)
+	}
+	if len(removed) != 0 {
+		removedResults, _ := o.forEachWorker(removed, o.removeWorker)
+		results = append(results, removedResults...)
+	}
+	if replicas == 0 {
+		// The worker keeps a status without replicas, so it is still reported.
+		o.status.Add(name, "", 0)
+	}
+	if len(results) == 0 {
+		return results, nil
+	}
+	return results, resultsError(results)
+}
+
+func (o *Orchestrator) setReplicas(name string, replicas int) (added []string, removed []string, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	workerConfig, ok := o.workerConfig(name)
+	if !ok {
+		return nil, nil, fmt.Errorf("worker <%s> not exists", name)
+	}
+	replicated := workerConfig.Replicas > 0 || workerConfig.Scaled
+	if !replicated {
+		if replicas == 1 {
+			return nil, nil, nil
+		}
+		for i := 0; i < len(o.workersConfig.Pipelines); i++ {
+			for _, step := range o.workersConfig.Pipelines[i].Steps {
+				if step.Worker == name {
+					return nil, nil, fmt.Errorf("worker <%s> is a step of pipeline <%s> and cannot have replicas", name, o.workersConfig.Pipelines[i].Name)
+				}
+			}
+		}
+	}
+	current := 0
+	if replicated {
+		current = workerConfig.Replicas
+	}
+	for i := current; i < replicas; i++ {
+		replicaName := dmnworker.ReplicaName(name, i)
+		if _, ok := o.currentAnts[replicaName]; ok {
+			return nil, nil, fmt.Errorf("worker <%s> already exists", replicaName)
+		}
+	}
+
+	// The template is kept, so a worker scaled to no replicas can be scaled up again.
+	template, ok := o.replicaTemplates[name]
+	if !ok {
+		template = o.currentAnts[dmnworker.InstanceNames(*workerConfig)[0]]
+		o.replicaTemplates[name] = template
+	}
+	if replicated && current == 0 && replicas > 0 {
+		o.status.Remove(name)
+	}
+	for i := current; i < replicas; i++ {
+		replicaName := dmnworker.ReplicaName(name, i)
+		o.currentAnts[replicaName] = worker.ReplicaAnt(template, name, i)
+		o.status.Add(replicaName, name, i)
+		added = append(added, replicaName)
+	}
+	if !replicated {
+		removed = append(removed, name)
+	}
+	for i := replicas; i < current; i++ {
+		removed = append(removed, dmnworker.ReplicaName(name, i))
+	}
+	workerConfig.Replicas = replicas
+	workerConfig.Scaled = true
+	return added, removed, nil
+}
+
+func (o *Orchestrator) removeWorker(name string) error {
+	o.stopJob(name)
+	if err := o.workerProcess(name).Stop(); err != nil && !errors.Is(err, process.ErrNotRunning) {
+		return err
+	}
+	o.processesMu.Lock()
+	delete(o.processes, name)
+	if streamer, ok := o.streams[name]; ok {
+		if err := streamer.Close(); err != nil {
+			log.Printf("close stream of %s: %s\n", name, err)
+		}
+		delete(o.streams, name)
+	}
+	o.processesMu.Unlock()
+
+	o.cancelWorkerJobs(name)
+	o.mu.Lock()
+	delete(o.currentAnts, name)
+	o.mu.Unlock()
+	o.status.Remove(name)
+	return nil
+}
@@ -0,0 +1,152 @@
+package orchestrator
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+	"github.com/uwine4850/anthill/pkg/infra/status"
+)
+
+func newScaleOrchestrator() *Orchestrator {
+	o := NewOrchestartor()
+	o.workersConfig = &parsecnf.WorkersConfig{
+		Workers: []dmnworker.WorkerConfig{{Name: "consumer", Type: "queue"}, {Name: "build", Type: "make"}},
+		Pipelines: []dmnworker.PipelineConfig{
+			{Name: "release", Steps: []dmnworker.StepConfig{{Name: "build", Worker: "build"}}},
+		},
+	}
+	o.currentAnts["consumer"] = dmnworker.PluginAnt{Path: "queue"}
+	o.currentAnts["build"] = dmnworker.PluginAnt{Path: "make"}
+	o.initStatus()
+	return &o
+}
+
+// removeInstances drops the removed instances like removeWorker, without processes.
+func (o *Orchestrator) removeInstances(names []string) {
+	for i := 0; i < len(names); i++ {
+		delete(o.currentAnts, names[i])
+		o.status.Remove(names[i])
+	}
+}
+
+func TestScaleWorkerWithoutReplicas(t *testing.T) {
+	o := newScaleOrchestrator()
+
+	added, removed, err := o.setReplicas("consumer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("scale to one replica changed the worker: added %v, removed %v", added, removed)
+	}
+
+	added, removed, err = o.setReplicas("consumer", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(added, []string{"consumer-0", "consumer-1", "consumer-2"}) || !slices.Equal(removed, []string{"consumer"}) {
+		t.Fatalf("added %v, removed %v", added, removed)
+	}
+	o.removeInstances(removed)
+	if ant := o.currentAnts["consumer-2"]; ant.Path != "queue" || ant.Parent != "consumer" || ant.Replica != 2 {
+		t.Fatalf("ant of consumer-2 = %+v", ant)
+	}
+	if names := o.instanceNames("consumer"); len(names) != 3 {
+		t.Fatalf("instances = %v", names)
+	}
+}
+
+func TestScaleToZero(t *testing.T) {
+	o := newScaleOrchestrator()
+	if _, removed, err := o.setReplicas("consumer", 2); err != nil {
+		t.Fatal(err)
+	} else {
+		o.removeInstances(removed)
+	}
+
+	added, removed, err := o.setReplicas("consumer", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || !slices.Equal(removed, []string{"consumer-0", "consumer-1"}) {
+		t.Fatalf("added %v, removed %v", added, removed)
+	}
+	o.removeInstances(removed)
+	if names := o.instanceNames("consumer"); len(names) != 0 {
+		t.Fatalf("instances of a worker without replicas = %v", names)
+	}
+
+	added, _, err = o.setReplicas("consumer", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(added, []string{"consumer-0"}) || o.currentAnts["consumer-0"].Path != "queue" {
+		t.Fatalf("added %v with ant %+v", added, o.currentAnts["consumer-0"])
+	}
+}
+
+func TestScaleRejects(t *testing.T) {
+	o := newScaleOrchestrator()
+	if _, err := o.scale("consumer", -1, time.Time{}); err == nil {
+		t.Fatal("negative number of replicas accepted")
+	}
+	if _, _, err := o.setReplicas("build", 2); err == nil {
+		t.Fatal("worker of a pipeline step was scaled")
+	}
+	if _, _, err := o.setReplicas("missing", 2); err == nil {
+		t.Fatal("missing worker was scaled")
+	}
+}
+
+func TestScaledToZeroStatus(t *testing.T) {
+	o := newScaleOrchestrator()
+	if _, err := o.scale("consumer", 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := o.statusTargets(dmnsocket.Request{Name: "consumer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"consumer"}) {
+		t.Fatalf("status targets = %v", names)
+	}
+	aggregated := status.Aggregate(o.status.Get())
+	if s, ok := aggregated["consumer"]; !ok || s.Active || len(s.Replicas) != 0 {
+		t.Fatalf("status of the worker without replicas = %+v, %v", s, ok)
+	}
+
+	if _, _, err := o.setReplicas("consumer", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := o.status.Get()["consumer"]; ok {
+		t.Fatal("status without replicas kept after scaling up")
+	}
+}
+
+func TestDependencyScaledToZero(t *testing.T) {
+	o := newScaleOrchestrator()
+	if _, err := o.scale("consumer", 0, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, pluginAnt := range []dmnworker.PluginAnt{{After: []string{"consumer"}}, {AfterReady: []string{"consumer"}}} {
+		done, failed := o.dependenciesDone(pluginAnt, o.status.Get())
+		if done || failed != "" {
+			t.Fatalf("dependency without replicas: done %v, failed %q", done, failed)
+		}
+	}
+
+	if _, _, err := o.setReplicas("consumer", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.status.SetDone("consumer-0"); err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := o.dependenciesDone(dmnworker.PluginAnt{After: []string{"consumer"}}, o.status.Get()); !done {
+		t.Fatal("dependency scaled up and done is not done")
+	}
+}
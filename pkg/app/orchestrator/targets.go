@@ -0,0 +1,139 @@
+package orchestrator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+	"github.com/uwine4850/anthill/pkg/infra/selector"
+	"github.com/uwine4850/anthill/pkg/infra/worker"
+)
+
+// resolveTargets returns the names of the workers addressed by the request.
+// The selector takes precedence over the all flag, which takes precedence over the name.
+// Workers with replicas are expanded to the names of their replicas.
+func (o *Orchestrator) resolveTargets(req dmnsocket.Request) ([]string, error) {
+	return o.targets(req, dmnworker.InstanceNames)
+}
+
+// statusTargets returns the names of the statuses addressed by the request. A worker
+// scaled to no replicas has its status under its own name.
+func (o *Orchestrator) statusTargets(req dmnsocket.Request) ([]string, error) {
+	return o.targets(req, func(workerConfig dmnworker.WorkerConfig) []string {
+		if names := dmnworker.InstanceNames(workerConfig); len(names) != 0 {
+			return names
+		}
+		return []string{workerConfig.Name}
+	})
+}
+
+func (o *Orchestrator) targets(req dmnsocket.Request, instanceNames func(workerConfig dmnworker.WorkerConfig) []string) ([]string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if req.Selector != "" {
+		sel, err := selector.Parse(req.Selector)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for i := 0; i < len(o.workersConfig.Workers); i++ {
+			if sel.Matches(o.workersConfig.Workers[i]) {
+				names = append(names, instanceNames(o.workersConfig.Workers[i])...)
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no workers match selector <%s>", req.Selector)
+		}
+		return names, nil
+	}
+	if req.All {
+		names := []string{}
+		for i := 0; i < len(o.workersConfig.Workers); i++ {
+			names = append(names, instanceNames(o.workersConfig.Workers[i])...)
+		}
+		return names, nil
+	}
+	if workerConfig, ok := o.workerConfig(req.Name); ok {
+		return instanceNames(*workerConfig), nil
+	}
+	if _, ok := o.currentAnts[req.Name]; !ok {
+		return nil, fmt.Errorf("worker <%s> not exists", req.Name)
+	}
+	return []string{req.Name}, nil
+}
+
+// instanceNames returns the instances of the worker, or the name itself if it is already an instance.
+func (o *Orchestrator) instanceNames(name string) []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if workerConfig, ok := o.workerConfig(name); ok {
+		return dmnworker.InstanceNames(*workerConfig)
+	}
+	return []string{name}
+}
+
+// workerConfig must be called with o.mu held.
+func (o *Orchestrator) workerConfig(name string) (*dmnworker.WorkerConfig, bool) {
+	for i := 0; i < len(o.workersConfig.Workers); i++ {
+		if o.workersConfig.Workers[i].Name == name {
+			return &o.workersConfig.Workers[i], true
+		}
+	}
+	return nil, false
+}
+
+// plan returns the stages in which all workers can be started.
+func (o *Orchestrator) plan() ([][]string, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return worker.PlanStages(o.workersConfig.Workers)
+}
+
+// forEachWorker applies fn to all workers concurrently and collects a result per worker.
+func (o *Orchestrator) forEachWorker(names []string, fn func(name string) error) ([]dmnsocket.WorkerResult, error) {
+	results := make([]dmnsocket.WorkerResult, len(names))
+	var wg sync.WaitGroup
+	for i := 0; i < len(names); i++ {
+		results[i].Name = names[i]
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(names[i]); err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results, resultsError(results)
+}
+
+// logTargets returns the stream sockets of the workers. The streams are open
+// whether the workers are running or not.
+func (o *Orchestrator) logTargets(names []string) []dmnsocket.WorkerResult {
+	results := make([]dmnsocket.WorkerResult, len(names))
+	for i := 0; i < len(names); i++ {
+		o.workerProcess(names[i])
+		results[i].Name = names[i]
+		results[i].Socket = process.StreamSocket(names[i])
+	}
+	return results
+}
+
+func resultsError(results []dmnsocket.WorkerResult) error {
+	if len(results) == 1 && results[0].Error != "" {
+		return errors.New(results[0].Error)
+	}
+	failed := 0
+	for i := 0; i < len(results); i++ {
+		if results[i].Error != "" {
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d workers failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package orchestrator
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+	"github.com/uwine4850/anthill/pkg/infra/process"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+// listenTLS listens on TCP with TLS and requires client certificates signed by the client CA.
+func listenTLS(tlsConfig parsecnf.TLSConfig) (net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(tlsConfig.Cert, tlsConfig.Key)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs, err := socket.LoadCertPool(tlsConfig.ClientCA)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", tlsConfig.Address, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+// followLogs relays the log stream of one worker on the connection, so the logs
+// can be followed by clients that cannot reach the stream sockets. The response
+// is followed by the records as JSON lines.
+func (o *Orchestrator) followLogs(ctx context.Context, conn io.Writer, req dmnsocket.Request) error {
+	names, err := o.resolveTargets(req)
+	if err != nil {
+		return sendResponse(conn, nil, err)
+	}
+	if len(names) != 1 {
+		return sendResponse(conn, nil, fmt.Errorf("worker <%s> has replicas, follow one of %v", req.Name, names))
+	}
+	o.workerProcess(names[0])
+	if err := sendResponse(conn, []dmnsocket.WorkerResult{{Name: names[0]}}, nil); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(conn)
+	return process.FollowStream(ctx, names[0], process.ReadOptions{}, func(record dmnprocess.LogRecord) error {
+		return enc.Encode(record)
+	})
+}
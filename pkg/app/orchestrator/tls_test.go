@@ -0,0 +1,235 @@
+package orchestrator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/infra/auth"
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	path string
+}
+
+// newTestCA creates a self-signed CA and writes its certificate to dir.
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name+".pem")
+	writePEM(t, path, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, path: path}
+}
+
+// issue writes a certificate signed by the CA and its key to dir and returns their paths.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := filepath.Join(dir, name+".pem")
+	keyPath := filepath.Join(dir, name+".key")
+	writePEM(t, certPath, "CERTIFICATE", der)
+	writePEM(t, keyPath, "EC PRIVATE KEY", keyDER)
+	return certPath, keyPath
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type tlsFixture struct {
+	dir      string
+	ca       *testCA
+	listener net.Listener
+	peers    chan peerResult
+}
+
+type peerResult struct {
+	peer *auth.Peer
+	err  error
+}
+
+// newTLSFixture starts a listener of listenTLS that answers every client whose
+// certificate is accepted with one byte and reports the peer of each connection.
+func newTLSFixture(t *testing.T) *tlsFixture {
+	t.Helper()
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	cert, key := ca.issue(t, dir, "orchestrator", x509.ExtKeyUsageServerAuth)
+	listener, err := listenTLS(parsecnf.TLSConfig{Address: "127.0.0.1:0", Cert: cert, Key: key, ClientCA: ca.path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	f := &tlsFixture{dir: dir, ca: ca, listener: listener, peers: make(chan peerResult, 1)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			peer, err := auth.TLSPeer(conn.(*tls.Conn))
+			if err == nil {
+				conn.Write([]byte{1})
+			}
+			conn.Close()
+			f.peers <- peerResult{peer: peer, err: err}
+		}
+	}()
+	return f
+}
+
+// connect connects with the client certificate through the socket client and
+// returns the error of the connection or of the first read.
+func (f *tlsFixture) connect(cert, key string) error {
+	socket.SetTarget(socket.Target{
+		Host:       f.listener.Addr().String(),
+		CA:         f.ca.path,
+		Cert:       cert,
+		Key:        key,
+		ServerName: "orchestrator",
+	})
+	defer socket.SetTarget(socket.Target{})
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	return err
+}
+
+func (f *tlsFixture) peer(t *testing.T) peerResult {
+	t.Helper()
+	select {
+	case result := <-f.peers:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection accepted")
+		return peerResult{}
+	}
+}
+
+func TestTLSMutualAuth(t *testing.T) {
+	f := newTLSFixture(t)
+	cert, key := f.ca.issue(t, f.dir, "deploy-bot", x509.ExtKeyUsageClientAuth)
+	if err := f.connect(cert, key); err != nil {
+		t.Fatalf("connect: %s", err)
+	}
+	result := f.peer(t)
+	if result.err != nil {
+		t.Fatalf("peer: %s", result.err)
+	}
+	if result.peer.Subject != "deploy-bot" {
+		t.Fatalf("subject = %q, want deploy-bot", result.peer.Subject)
+	}
+}
+
+func TestTLSRejectsClientWithoutCert(t *testing.T) {
+	f := newTLSFixture(t)
+	if err := f.connect("", ""); err == nil {
+		t.Fatal("client without certificate was accepted")
+	}
+	if result := f.peer(t); result.err == nil {
+		t.Fatalf("peer %s was accepted", result.peer)
+	}
+}
+
+func TestTLSRejectsUnknownCA(t *testing.T) {
+	f := newTLSFixture(t)
+	other := newTestCA(t, t.TempDir(), "other")
+	cert, key := other.issue(t, f.dir, "intruder", x509.ExtKeyUsageClientAuth)
+	if err := f.connect(cert, key); err == nil {
+		t.Fatal("client certificate of an unknown CA was accepted")
+	}
+	if result := f.peer(t); result.err == nil {
+		t.Fatalf("peer %s was accepted", result.peer)
+	}
+}
+
+func TestTLSSubjectRole(t *testing.T) {
+	f := newTLSFixture(t)
+	cert, key := f.ca.issue(t, f.dir, "deploy-bot", x509.ExtKeyUsageClientAuth)
+	if err := f.connect(cert, key); err != nil {
+		t.Fatalf("connect: %s", err)
+	}
+	result := f.peer(t)
+	if result.err != nil {
+		t.Fatalf("peer: %s", result.err)
+	}
+
+	authorizer, err := auth.NewAuthorizer(&parsecnf.AuthConfig{
+		DefaultRole: "viewer",
+		Subjects:    []parsecnf.RoleBinding{{Name: "deploy-bot", Role: "operator"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := authorizer.PeerRole(result.peer); role != auth.ROLE_OPERATOR {
+		t.Fatalf("role of deploy-bot = %v, want operator", role)
+	}
+	if role := authorizer.PeerRole(&auth.Peer{Subject: "someone-else"}); role != auth.ROLE_VIEWER {
+		t.Fatalf("role of an unbound subject = %v, want viewer", role)
+	}
+}
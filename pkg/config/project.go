@@ -1,4 +1,94 @@
 package config
 
+import "time"
+
 const ANTHILL_SOCKET_PATH = "/tmp/anthill.sock"
 const EXPORT_PLUGIN_NAME = "Plugin"
+const EXPORT_METADATA_NAME = "Metadata"
+
+// PLUGIN_API_VERSION is the version of the WorkerAnt interface plugins must be built against.
+const PLUGIN_API_VERSION = 1
+
+const ENV_WORKER_NAME = "ANTHILL_WORKER_NAME"
+const ENV_REPLICA_INDEX = "ANTHILL_REPLICA_INDEX"
+const ENV_OUTPUTS_DIR = "ANTHILL_OUTPUTS_DIR"
+
+// ENV_CONTROL_FD is the file descriptor of the pipe a worker sends its notifications through.
+const ENV_CONTROL_FD = "ANTHILL_CONTROL_FD"
+
+// OUTPUTS_DIR holds a directory of outputs per worker, relative to the working directory of the orchestrator.
+const OUTPUTS_DIR = "outputs"
+
+// STOP_TIMEOUT is how long a worker has to exit after SIGTERM before it is killed.
+const STOP_TIMEOUT = 10 * time.Second
+
+// RESTART_SETTLE_TIME is how long a restarted worker must stay alive to be considered running.
+const RESTART_SETTLE_TIME = 2 * time.Second
+
+// RESTART_READY_TIMEOUT is how long a restarted worker that reports readiness has to
+// become ready before its restart counts as failed.
+const RESTART_READY_TIMEOUT = 60 * time.Second
+const RESTART_READY_POLL_INTERVAL = 100 * time.Millisecond
+
+// LOG_MAX_SIZE is the default size in bytes at which a worker log file is rotated.
+const LOG_MAX_SIZE = 10 * 1024 * 1024
+
+// LOG_RETAIN is the default number of rotated log files kept per worker.
+const LOG_RETAIN = 5
+
+// STREAM_SUBSCRIBER_BUFFER is how many lines a log stream client may fall behind before it is dropped.
+const STREAM_SUBSCRIBER_BUFFER = 1024
+
+// TAIL_MERGE_WINDOW is how long records of several workers are held back to print them in time order.
+const TAIL_MERGE_WINDOW = 300 * time.Millisecond
+
+// TAIL_REFRESH_INTERVAL is how often a multi-worker tail looks for newly started workers.
+const TAIL_REFRESH_INTERVAL = 2 * time.Second
+
+const SINK_BATCH_SIZE = 100
+const SINK_FLUSH_INTERVAL = time.Second
+const SINK_RETRY_DELAY = 500 * time.Millisecond
+const SINK_HTTP_TIMEOUT = 10 * time.Second
+
+// SINK_QUEUE_BATCHES is how many batches an http sink queues before it drops records.
+const SINK_QUEUE_BATCHES = 10
+
+// LOG_MAX_LINE_BYTES is the default length at which a line of worker output is truncated or split.
+const LOG_MAX_LINE_BYTES = 64 * 1024
+
+// AUDIT_LOG_PATH is the default audit log of the orchestrator, relative to its working directory.
+const AUDIT_LOG_PATH = "audit.log"
+
+// EXEC_PLUGIN_CALL_TIMEOUT is how long an executable plugin has to answer a call other than Run.
+const EXEC_PLUGIN_CALL_TIMEOUT = 10 * time.Second
+
+// EXEC_PLUGIN_CLOSE_TIMEOUT is how long an executable plugin has to exit after its stdin is closed.
+const EXEC_PLUGIN_CLOSE_TIMEOUT = 5 * time.Second
+
+// REQUEST_READ_TIMEOUT is how long a client has to send its request after connecting.
+const REQUEST_READ_TIMEOUT = 10 * time.Second
+
+// RESPONSE_WRITE_TIMEOUT is how long a write of a response may block on a slow client.
+const RESPONSE_WRITE_TIMEOUT = 10 * time.Second
+
+const MAX_REQUEST_BYTES = 64 * 1024
+const MAX_CONNECTIONS = 128
+
+// DEADLINE_GRACE is how long a client waits for the response after the deadline of its request.
+const DEADLINE_GRACE = 5 * time.Second
+
+// OUTPUT_DRAIN_TIMEOUT is how long the output of an exited worker is still read.
+const OUTPUT_DRAIN_TIMEOUT = 2 * time.Second
+
+// READINESS_INTERVAL and READINESS_TIMEOUT are the defaults of a readiness probe.
+const READINESS_INTERVAL = time.Second
+const READINESS_TIMEOUT = time.Second
+
+// JOBS_HISTORY is how many finished jobs are kept for the jobs action.
+const JOBS_HISTORY = 100
+
+// JOB_POLL_INTERVAL is how often a client checks a job it waits for.
+const JOB_POLL_INTERVAL = 500 * time.Millisecond
+
+// PIPELINE_HISTORY_PATH is the default file of finished pipeline runs, relative to the working directory of the orchestrator.
+const PIPELINE_HISTORY_PATH = "pipelines.jsonl"
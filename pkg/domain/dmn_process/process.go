@@ -1,9 +1,53 @@
 package dmnprocess
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
+const (
+	STREAM_STDOUT = "stdout"
+	STREAM_STDERR = "stderr"
+	// STREAM_SYSTEM marks records written by anthill itself rather than the worker.
+	STREAM_SYSTEM = "anthill"
+)
+
+const (
+	OVERFLOW_TRUNCATE = "truncate"
+	OVERFLOW_SPLIT    = "split"
+)
+
+// Streamer is the long-lived log stream of one worker. It outlives the runs of
+// the worker, which are separated by StartRun and EndRun events.
 type Streamer interface {
 	io.Closer
-	ReadText(reader io.Reader)
+	ReadText(reader io.Reader, stream string)
 	Stream() error
+	StartRun(generation int)
+	EndRun(generation int, err error)
+	LineCounts() map[string]int64
+	ForSlot(slot int) Streamer
+}
+
+// LogSink receives every record of the workers it is configured for.
+// Write must not block the worker output for long.
+type LogSink interface {
+	io.Closer
+	Write(record LogRecord) error
+}
+
+// LogRecord is a single line of worker output. Parent and Replica are set only for replicas,
+// Generation counts the runs of the worker since the orchestrator started. Slot is set for the
+// parallel runs of a job after the first, each slot counts its own runs.
+type LogRecord struct {
+	Time       time.Time `json:"time"`
+	Stream     string    `json:"stream"`
+	Worker     string    `json:"worker"`
+	Parent     string    `json:"parent,omitempty"`
+	Replica    int       `json:"replica,omitempty"`
+	Generation int       `json:"generation"`
+	Slot       int       `json:"slot,omitempty"`
+	Level      string    `json:"level,omitempty"`
+	Line       string    `json:"line"`
+	Truncated  bool      `json:"truncated,omitempty"`
 }
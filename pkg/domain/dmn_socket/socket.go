@@ -1,6 +1,38 @@
 package dmnsocket
 
+import "time"
+
 type Request struct {
-	Action string `json:"action"`
+	Action   string `json:"action"`
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+	All      bool   `json:"all"`
+	Parallel int    `json:"parallel"`
+	Replicas int    `json:"replicas"`
+	// Follow makes a logs request stream the records of the worker on the connection.
+	Follow bool `json:"follow"`
+	// Since limits an audit request to the entries since the time.
+	Since time.Time `json:"since"`
+	// Deadline cancels a start that is still waiting for its dependencies.
+	Deadline time.Time `json:"deadline"`
+	// Job is the ID of the job of a job or cancel request.
+	Job int `json:"job"`
+	// Run is the ID of a pipeline run, Step is the step a resumed run starts from.
+	Run  int    `json:"run"`
+	Step string `json:"step"`
+}
+
+type WorkerResult struct {
 	Name   string `json:"name"`
+	Error  string `json:"error"`
+	Socket string `json:"socket,omitempty"`
+	// Job is the ID of a start that waits for the dependencies of the worker.
+	Job int `json:"job,omitempty"`
+}
+
+type Response struct {
+	Results []WorkerResult `json:"results"`
+	// Stages is the start plan of a plan request, the workers of a stage can start in parallel.
+	Stages [][]string `json:"stages,omitempty"`
+	Error  string     `json:"error"`
 }
@@ -0,0 +1,15 @@
+package dmnworker
+
+// PipelineConfig is a named workflow built from workers. Each step runs its worker
+// once the steps it is after have succeeded.
+type PipelineConfig struct {
+	Name  string
+	Steps []StepConfig
+}
+
+// StepConfig is a step of a pipeline. The name defaults to the name of the worker.
+type StepConfig struct {
+	Name   string
+	Worker string
+	After  []string
+}
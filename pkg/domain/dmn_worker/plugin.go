@@ -1,13 +1,50 @@
 package dmnworker
 
 type PluginsConfig struct {
-	Plugins []string
+	Plugins    []string
+	PluginDirs []string `yaml:"plugin_dirs"`
+}
+
+// PluginManifest describes an executable plugin found in a plugin directory.
+// The exec path is relative to the directory of the manifest.
+type PluginManifest struct {
+	Exec string `yaml:"exec"`
+}
+
+// PluginInfo describes a discovered plugin and the result of loading it.
+type PluginInfo struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind"`
+	Source  string `json:"source"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Error   string `json:"error"`
+}
+
+// PluginMetadata is exported by every plugin so the loader can check
+// that the plugin was built for the current WorkerAnt interface.
+type PluginMetadata struct {
+	APIVersion   int      `json:"api_version"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	Capabilities []string `json:"capabilities"`
 }
 
 type PluginAnt struct {
-	Path      string
-	Reload    bool
-	After     []string
-	Args      []string
-	WorkerAnt WorkerAnt
+	Path       string
+	Kind       string
+	Job        JobConfig
+	Reload     bool
+	After      []string
+	AfterReady []string
+	Readiness  ReadinessConfig
+	Args       []string
+	Env        map[string]string
+	Parent     string
+	Replica    int
+	Metadata   PluginMetadata
+	Log        LogConfig
+	Sinks      []SinkConfig
+	WorkerAnt  WorkerAnt
 }
@@ -1,5 +1,12 @@
 package dmnworker
 
+import (
+	"fmt"
+	"time"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+)
+
 type WorkerAnt interface {
 	Run() error
 	Stop() error
@@ -8,17 +15,129 @@ type WorkerAnt interface {
 	Args(args ...string) error
 }
 
+// Kinds of workers. A service runs until it is stopped, a job runs to completion.
+const (
+	KIND_SERVICE = "service"
+	KIND_JOB     = "job"
+)
+
 type WorkerConfig struct {
-	Name   string
-	Reload bool
-	Type   string
-	After  []string
-	Args   []string
+	Name       string
+	Kind       string
+	Reload     bool
+	Type       string
+	After      []string
+	AfterReady []string `yaml:"after_ready"`
+	Args       []string
+	Env        map[string]string
+	Group      string
+	Labels     map[string]string
+	Replicas   int
+	Job        JobConfig
+	Readiness  ReadinessConfig
+	Log        LogConfig
+	Sinks      []SinkConfig
+	// Scaled is set once the worker was scaled at runtime. It then has Replicas
+	// instances named as replicas, even if that is one or none.
+	Scaled bool `yaml:"-"`
+}
+
+// JobConfig configures a worker of kind job. The job is complete once Completions runs
+// exited with code zero, with at most Parallelism runs at a time. It fails after more
+// than Retries failed runs or once it has run for ActiveDeadline.
+type JobConfig struct {
+	Completions    int           `yaml:"completions"`
+	Parallelism    int           `yaml:"parallelism"`
+	Retries        int           `yaml:"retries"`
+	ActiveDeadline time.Duration `yaml:"active_deadline"`
+}
+
+// ReadinessConfig configures the probe that marks a running service as ready. One of
+// TCP, HTTP and Exec is set. The probe runs every Interval until it passes once.
+type ReadinessConfig struct {
+	TCP      string        `yaml:"tcp"`
+	HTTP     string        `yaml:"http"`
+	Exec     []string      `yaml:"exec"`
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// IsSet reports whether a probe is configured.
+func (r ReadinessConfig) IsSet() bool {
+	return r.TCP != "" || r.HTTP != "" || len(r.Exec) > 0
+}
+
+// LogConfig configures how the output of a worker is captured. Log files are written only if Dir is set.
+// Overflow is truncate or split and decides what happens to lines longer than MaxLineBytes.
+type LogConfig struct {
+	Dir          string        `yaml:"dir"`
+	MaxSize      int64         `yaml:"max_size"`
+	MaxAge       time.Duration `yaml:"max_age"`
+	Compress     bool          `yaml:"compress"`
+	Retain       int           `yaml:"retain"`
+	HistoryLines int           `yaml:"history_lines"`
+	MaxLineBytes int           `yaml:"max_line_bytes"`
+	Overflow     string        `yaml:"overflow"`
+}
+
+// SinkConfig configures where worker records are forwarded. Type is one of
+// syslog, file, http or stdout; the other fields apply to some types only.
+type SinkConfig struct {
+	Type          string        `yaml:"type"`
+	Address       string        `yaml:"address"`
+	Tag           string        `yaml:"tag"`
+	Path          string        `yaml:"path"`
+	URL           string        `yaml:"url"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	Retries       int           `yaml:"retries"`
 }
 
 type AWorkerProcess interface {
 	Run() error
 	Stop() error
-	OnDone(fn func())
-	New(ants *map[string]PluginAnt, name string) AWorkerProcess
+	Restart() error
+	Done() <-chan struct{}
+	// OnDone sets the function called after every run with the error of the exit,
+	// which is nil for a zero exit code and for a requested stop.
+	OnDone(fn func(err error))
+	OnReady(fn func())
+	OnReload(fn func())
+	Stats() ProcessStats
+	SetPluginAnt(pluginAnt PluginAnt)
+	New(pluginAnt PluginAnt, name string, streamer dmnprocess.Streamer) AWorkerProcess
+}
+
+// ProcessStats describes the runs of a worker process. Pid is zero while the worker is not running.
+type ProcessStats struct {
+	Pid      int
+	Runs     int
+	ExitCode int
+	Exited   bool
+	Ready    bool
+}
+
+func ReplicaName(name string, index int) string {
+	return fmt.Sprintf("%s-%d", name, index)
+}
+
+// SlotName names the parallel run of a job in the given slot. Slot 0 runs under the name of the worker.
+func SlotName(name string, slot int) string {
+	if slot == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s#%d", name, slot)
+}
+
+// InstanceNames returns the names of the processes created for the worker.
+// A worker without replicas has a single instance named after the worker itself.
+func InstanceNames(workerConfig WorkerConfig) []string {
+	if workerConfig.Replicas <= 0 && !workerConfig.Scaled {
+		return []string{workerConfig.Name}
+	}
+	names := make([]string, workerConfig.Replicas)
+	for i := 0; i < workerConfig.Replicas; i++ {
+		names[i] = ReplicaName(workerConfig.Name, i)
+	}
+	return names
 }
@@ -0,0 +1,248 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KEY_SIZE is the size in bytes of the generated key and the minimum size of a configured one.
+const KEY_SIZE = 32
+
+// Entry is one control action. Hash is an HMAC of the entry with its Prev hash, so
+// changing or removing an entry breaks the chain of all later entries, and the chain
+// cannot be recomputed without the key.
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Peer    string            `json:"peer"`
+	Action  string            `json:"action"`
+	Target  string            `json:"target,omitempty"`
+	Params  map[string]string `json:"params,omitempty"`
+	Outcome string            `json:"outcome"`
+	Prev    string            `json:"prev"`
+	Hash    string            `json:"hash"`
+}
+
+func (e Entry) hash(key []byte) (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Head is the number of entries of the log and the hash of the last one. It is
+// kept in a file next to the log, so cutting off the last entries is detected.
+type Head struct {
+	Entries int    `json:"entries"`
+	Hash    string `json:"hash"`
+}
+
+// Log appends entries to the audit file.
+type Log struct {
+	mu       sync.Mutex
+	path     string
+	headPath string
+	key      []byte
+	file     *os.File
+	head     Head
+}
+
+// Open opens the audit file for appending and continues the chain of its last entry.
+// The HMAC key is read from keyPath and created there if it does not exist. A log
+// that is shorter than its head is recorded with an entry of its own.
+func Open(path string, keyPath string) (*Log, error) {
+	key, err := loadKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{path: path, headPath: path + ".head", key: key}
+	err = readEntries(path, func(entry Entry) error {
+		l.head.Entries++
+		l.head.Hash = entry.Hash
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	saved, err := readHead(l.headPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l.file = file
+	if saved.Entries > l.head.Entries {
+		err := l.Append(Entry{
+			Time:    time.Now(),
+			Peer:    "orchestrator",
+			Action:  "audit",
+			Outcome: fmt.Sprintf("error: audit log truncated, %d entries expected, %d found", saved.Entries, l.head.Entries),
+		})
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// loadKey reads the hex encoded key, or creates a random one readable only by the owner.
+// A short key would let anyone recompute the chain, so it is rejected.
+func loadKey(keyPath string) ([]byte, error) {
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("audit key %s: %s", keyPath, err)
+		}
+		if len(key) < KEY_SIZE {
+			return nil, fmt.Errorf("audit key %s has %d bytes, at least %d are required", keyPath, len(key), KEY_SIZE)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key := make([]byte, KEY_SIZE)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func readHead(path string) (Head, error) {
+	var head Head
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return head, err
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return head, fmt.Errorf("audit head %s: %s", path, err)
+	}
+	return head, nil
+}
+
+// writeHead replaces the head file, so a crash never leaves a partial head.
+func (l *Log) writeHead(head Head) error {
+	data, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+	tmp := l.headPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.headPath)
+}
+
+func (l *Log) Append(entry Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.Prev = l.head.Hash
+	hash, err := entry.hash(l.key)
+	if err != nil {
+		return err
+	}
+	entry.Hash = hash
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.head = Head{Entries: l.head.Entries + 1, Hash: hash}
+	return l.writeHead(l.head)
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Read returns the entries since the time and the head the chain was verified up to.
+// Entries appended during the read are left out, so appends are not blocked. A broken
+// link, or a log shorter than the head, is reported in tampered without stopping the read.
+func (l *Log) Read(since time.Time) (entries []Entry, head Head, tampered string, err error) {
+	l.mu.Lock()
+	head = l.head
+	l.mu.Unlock()
+	prev := ""
+	line := 0
+	err = readEntries(l.path, func(entry Entry) error {
+		if line == head.Entries {
+			return errStop
+		}
+		line++
+		hash, err := entry.hash(l.key)
+		if err != nil {
+			return err
+		}
+		if tampered == "" && (entry.Prev != prev || entry.Hash != hash) {
+			tampered = fmt.Sprintf("audit chain broken at entry %d (%s)", line, entry.Time.Format(time.RFC3339))
+		}
+		prev = entry.Hash
+		if !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err == errStop {
+		err = nil
+	}
+	if err == nil && tampered == "" && (line != head.Entries || prev != head.Hash) {
+		tampered = fmt.Sprintf("audit log ends at entry %d, its head is at entry %d", line, head.Entries)
+	}
+	return entries, head, tampered, err
+}
+
+var errStop = errors.New("stop reading")
+
+func readEntries(path string, fn func(entry Entry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) != 0 {
+			// An unreadable line is passed as an empty entry, which breaks the chain.
+			var entry Entry
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				entry = Entry{}
+			}
+			if fnErr := fn(entry); fnErr != nil {
+				return fnErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenRejectsShortKey(t *testing.T) {
+	for _, key := range []string{"", "  \n", "00112233"} {
+		dir := t.TempDir()
+		keyPath := filepath.Join(dir, "audit.key")
+		if err := os.WriteFile(keyPath, []byte(key), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if l, err := Open(filepath.Join(dir, "audit.log"), keyPath); err == nil {
+			l.Close()
+			t.Fatalf("key %q was accepted", key)
+		}
+	}
+}
+
+func TestOpenCreatesKey(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "audit.key")
+	l, err := Open(filepath.Join(dir, "audit.log"), keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	key, err := loadKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != KEY_SIZE {
+		t.Fatalf("key has %d bytes", len(key))
+	}
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+type AuditResponse struct {
+	Entries  []Entry
+	Head     Head
+	Tampered string
+	Error    string
+}
+
+func SendAuditResponse(w io.Writer, log *Log, since time.Time) error {
+	if log == nil {
+		return socket.SendRequest(w, &AuditResponse{Error: "audit log is disabled"})
+	}
+	entries, head, tampered, err := log.Read(since)
+	if err != nil {
+		return socket.SendRequest(w, &AuditResponse{Error: err.Error()})
+	}
+	return socket.SendRequest(w, &AuditResponse{Entries: entries, Head: head, Tampered: tampered})
+}
+
+// ReadAudit returns the audit entries of the orchestrator since the time.
+func ReadAudit(since time.Time) (*AuditResponse, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := dmnsocket.Request{Action: "audit", Since: since}
+	if err := socket.SendRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	var resp AuditResponse
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+)
+
+type Role int
+
+const (
+	ROLE_NONE Role = iota
+	ROLE_VIEWER
+	ROLE_OPERATOR
+	ROLE_ADMIN
+)
+
+func ParseRole(name string) Role {
+	switch name {
+	case "viewer":
+		return ROLE_VIEWER
+	case "operator":
+		return ROLE_OPERATOR
+	case "admin":
+		return ROLE_ADMIN
+	default:
+		return ROLE_NONE
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case ROLE_VIEWER:
+		return "viewer"
+	case ROLE_OPERATOR:
+		return "operator"
+	case ROLE_ADMIN:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// actionRoles is the minimal role of each action. Actions that are not listed require admin.
+var actionRoles = map[string]Role{
+	"status":          ROLE_VIEWER,
+	"logs":            ROLE_VIEWER,
+	"plugins":         ROLE_VIEWER,
+	"jobs":            ROLE_VIEWER,
+	"job":             ROLE_VIEWER,
+	"plan":            ROLE_VIEWER,
+	"pipeline_status": ROLE_VIEWER,
+	"run":             ROLE_OPERATOR,
+	"stop":            ROLE_OPERATOR,
+	"restart":         ROLE_OPERATOR,
+	"scale":           ROLE_OPERATOR,
+	"cancel":          ROLE_OPERATOR,
+	"pipeline_run":    ROLE_OPERATOR,
+	"pipeline_resume": ROLE_OPERATOR,
+	"reload":          ROLE_ADMIN,
+}
+
+func ActionRole(action string) Role {
+	if role, ok := actionRoles[action]; ok {
+		return role
+	}
+	return ROLE_ADMIN
+}
+
+// Authorizer decides the role of socket peers and HTTP tokens.
+type Authorizer struct {
+	defaultRole Role
+	users       map[int]Role
+	groups      map[int]Role
+	subjects    map[string]Role
+	tokens      []token
+}
+
+type token struct {
+	name  string
+	value []byte
+	role  Role
+}
+
+// NewAuthorizer resolves the user and group names of the config to ids.
+func NewAuthorizer(authConfig *parsecnf.AuthConfig) (*Authorizer, error) {
+	a := &Authorizer{
+		defaultRole: ParseRole(authConfig.DefaultRole),
+		users:       make(map[int]Role),
+		groups:      make(map[int]Role),
+		subjects:    make(map[string]Role),
+	}
+	for i := 0; i < len(authConfig.Subjects); i++ {
+		a.subjects[authConfig.Subjects[i].Name] = ParseRole(authConfig.Subjects[i].Role)
+	}
+	for i := 0; i < len(authConfig.Users); i++ {
+		uid, err := lookupID(authConfig.Users[i].Name, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		a.users[uid] = ParseRole(authConfig.Users[i].Role)
+	}
+	for i := 0; i < len(authConfig.Groups); i++ {
+		gid, err := lookupID(authConfig.Groups[i].Name, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		a.groups[gid] = ParseRole(authConfig.Groups[i].Role)
+	}
+	for i := 0; i < len(authConfig.Tokens); i++ {
+		t := authConfig.Tokens[i]
+		a.tokens = append(a.tokens, token{name: t.Name, value: []byte(t.Token), role: ParseRole(t.Role)})
+	}
+	return a, nil
+}
+
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	id, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// PeerRole returns the highest role of the peer by its user, its groups or the default role.
+// A peer connected over TLS is identified by its certificate subject only.
+func (a *Authorizer) PeerRole(peer *Peer) Role {
+	if peer.Subject != "" {
+		return max(a.defaultRole, a.subjects[peer.Subject])
+	}
+	if peer.UID == 0 || peer.UID == os.Getuid() {
+		return ROLE_ADMIN
+	}
+	role := a.defaultRole
+	if userRole, ok := a.users[peer.UID]; ok {
+		role = max(role, userRole)
+	}
+	for _, gid := range peerGroups(peer) {
+		if groupRole, ok := a.groups[gid]; ok {
+			role = max(role, groupRole)
+		}
+	}
+	return role
+}
+
+// TokenRole returns the role of the token and the name it was configured with.
+func (a *Authorizer) TokenRole(value string) (Role, string) {
+	for i := 0; i < len(a.tokens); i++ {
+		if subtle.ConstantTimeCompare(a.tokens[i].value, []byte(value)) == 1 {
+			return a.tokens[i].role, a.tokens[i].name
+		}
+	}
+	return ROLE_NONE, ""
+}
+
+// Authorize returns an error if the role may not perform the action.
+func Authorize(role Role, action string) error {
+	required := ActionRole(action)
+	if role < required {
+		return fmt.Errorf("permission denied: <%s> requires the %s role", action, required)
+	}
+	return nil
+}
+
+// peerGroups returns the primary and supplementary groups of the peer.
+func peerGroups(peer *Peer) []int {
+	gids := []int{peer.GID}
+	u, err := user.LookupId(strconv.Itoa(peer.UID))
+	if err != nil {
+		return gids
+	}
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return gids
+	}
+	for _, groupId := range groupIds {
+		if gid, err := strconv.Atoi(groupId); err == nil && !slices.Contains(gids, gid) {
+			gids = append(gids, gid)
+		}
+	}
+	return gids
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+// Peer identifies the client of a request. Unix socket peers have their
+// credentials, TLS clients the subject of their certificate and HTTP clients
+// the name of their token.
+type Peer struct {
+	UID     int
+	GID     int
+	PID     int
+	Subject string
+	Token   string
+	// Address is the remote address of an HTTP client.
+	Address string
+}
+
+func (p *Peer) String() string {
+	if p.Token != "" {
+		return "token:" + p.Token
+	}
+	if p.Subject != "" {
+		return "subject:" + p.Subject
+	}
+	if p.Address != "" {
+		return "http:" + p.Address
+	}
+	return fmt.Sprintf("uid:%d pid:%d", p.UID, p.PID)
+}
+
+// TLSPeer returns the subject of the client certificate of the TLS connection.
+func TLSPeer(conn *tls.Conn) (*Peer, error) {
+	if err := conn.Handshake(); err != nil {
+		return nil, err
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no client certificate")
+	}
+	return &Peer{Subject: certs[0].Subject.CommonName}, nil
+}
+
+// ListenSocket listens on the unix socket with its configured permissions. They
+// are applied before the socket can be reached, see socket.ListenUnix.
+func ListenSocket(path string, socketConfig parsecnf.SocketConfig) (net.Listener, error) {
+	return socket.ListenUnix(path, func(path string) error {
+		return ApplySocketPermissions(path, socketConfig)
+	})
+}
+
+// ApplySocketPermissions sets the mode and the group of the socket file.
+func ApplySocketPermissions(path string, socketConfig parsecnf.SocketConfig) error {
+	if socketConfig.Group != "" {
+		gid, err := lookupID(socketConfig.Group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, -1, gid); err != nil {
+			return err
+		}
+	}
+	if socketConfig.Mode != "" {
+		mode, err := strconv.ParseUint(socketConfig.Mode, 8, 32)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
+)
+
+func socketMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestListenSocketMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anthill.sock")
+	listener, err := ListenSocket(path, parsecnf.SocketConfig{Mode: "0660"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if mode := socketMode(t, path); mode != 0660 {
+		t.Fatalf("mode = %o, want 660", mode)
+	}
+}
+
+func TestListenSocketDefaultMode(t *testing.T) {
+	umask := syscall.Umask(0022)
+	defer syscall.Umask(umask)
+	path := filepath.Join(t.TempDir(), "anthill.sock")
+	listener, err := ListenSocket(path, parsecnf.SocketConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if mode := socketMode(t, path); mode != 0755 {
+		t.Fatalf("mode = %o, want 755", mode)
+	}
+}
+
+func TestListenSocketClose(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "anthill.sock")
+	listener, err := ListenSocket(path, parsecnf.SocketConfig{Mode: "0600"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "anthill.sock" {
+		t.Fatalf("files next to the socket: %v", entries)
+	}
+	if err := listener.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket still exists after close: %v", err)
+	}
+}
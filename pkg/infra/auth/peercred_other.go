@@ -0,0 +1,12 @@
+//go:build !linux
+
+package auth
+
+import (
+	"errors"
+	"net"
+)
+
+func PeerCredentials(conn net.Conn) (*Peer, error) {
+	return nil, errors.New("peer credentials are only supported on linux")
+}
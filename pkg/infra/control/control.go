@@ -0,0 +1,50 @@
+package control
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/uwine4850/anthill/pkg/config"
+)
+
+// NOTIFY_READY is sent by a worker once it is ready to serve its dependents.
+const NOTIFY_READY = "ready"
+
+var (
+	pipeOnce sync.Once
+	pipe     *os.File
+	pipeErr  error
+	writeMu  sync.Mutex
+)
+
+// Ready tells the orchestrator that the running worker is ready. The workers that
+// start after_ready of it are started then.
+func Ready() error {
+	return Notify(NOTIFY_READY)
+}
+
+// Notify writes a notification to the control pipe of the running worker.
+func Notify(notification string) error {
+	pipeOnce.Do(func() {
+		value := os.Getenv(config.ENV_CONTROL_FD)
+		if value == "" {
+			pipeErr = fmt.Errorf("%s is not set", config.ENV_CONTROL_FD)
+			return
+		}
+		fd, err := strconv.Atoi(value)
+		if err != nil {
+			pipeErr = fmt.Errorf("invalid %s: %s", config.ENV_CONTROL_FD, err)
+			return
+		}
+		pipe = os.NewFile(uintptr(fd), "control")
+	})
+	if pipeErr != nil {
+		return pipeErr
+	}
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	_, err := fmt.Fprintln(pipe, notification)
+	return err
+}
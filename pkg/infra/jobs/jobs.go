@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+type State string
+
+const (
+	STATE_PENDING   State = "pending"
+	STATE_STARTED   State = "started"
+	STATE_FAILED    State = "failed"
+	STATE_CANCELLED State = "cancelled"
+)
+
+// Job is a start of a worker that waits for its dependencies in the orchestrator,
+// independently of the client that requested it.
+type Job struct {
+	ID       int       `json:"id"`
+	Worker   string    `json:"worker"`
+	After    []string  `json:"after"`
+	State    State     `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+	Deadline time.Time `json:"deadline"`
+}
+
+type Jobs struct {
+	mu   sync.Mutex
+	next int
+	jobs map[int]*Job
+	// finished are the IDs of finished jobs, oldest first.
+	finished []int
+}
+
+func NewJobs() *Jobs {
+	return &Jobs{
+		next: 1,
+		jobs: make(map[int]*Job),
+	}
+}
+
+// Add creates a pending job of the worker.
+func (j *Jobs) Add(worker string, after []string, deadline time.Time) Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	job := &Job{
+		ID:       j.next,
+		Worker:   worker,
+		After:    after,
+		State:    STATE_PENDING,
+		Created:  now,
+		Updated:  now,
+		Deadline: deadline,
+	}
+	j.jobs[job.ID] = job
+	j.next++
+	return *job
+}
+
+func (j *Jobs) Get(id int) (Job, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job <%d> not exists", id)
+	}
+	return *job, nil
+}
+
+// List returns all known jobs ordered by ID.
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	list := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].ID < list[b].ID
+	})
+	return list
+}
+
+// Finish records the result of the start of a pending job.
+func (j *Jobs) Finish(id int, err error) {
+	if err != nil {
+		j.setState(id, STATE_FAILED, err.Error())
+		return
+	}
+	j.setState(id, STATE_STARTED, "")
+}
+
+// Cancel records that a pending job will not be started.
+func (j *Jobs) Cancel(id int, reason string) {
+	j.setState(id, STATE_CANCELLED, reason)
+}
+
+func (j *Jobs) setState(id int, state State, reason string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job, ok := j.jobs[id]
+	if !ok || job.State != STATE_PENDING {
+		return
+	}
+	job.State = state
+	job.Error = reason
+	job.Updated = time.Now()
+	j.finished = append(j.finished, id)
+	for len(j.finished) > config.JOBS_HISTORY {
+		delete(j.jobs, j.finished[0])
+		j.finished = j.finished[1:]
+	}
+}
+
+type JobsResponse struct {
+	Jobs  []Job
+	Error string
+}
+
+func SendJobsResponse(w io.Writer, jobs []Job, err error) error {
+	resp := JobsResponse{Jobs: jobs}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return socket.SendRequest(w, &resp)
+}
+
+// ListJobs returns the jobs known to the orchestrator.
+func ListJobs() ([]Job, error) {
+	return sendJobsRequest(dmnsocket.Request{Action: "jobs"})
+}
+
+func GetJob(id int) (*Job, error) {
+	jobs, err := sendJobsRequest(dmnsocket.Request{Action: "job", Job: id})
+	if err != nil {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// CancelJob cancels a pending job and returns it.
+func CancelJob(id int) (*Job, error) {
+	jobs, err := sendJobsRequest(dmnsocket.Request{Action: "cancel", Job: id})
+	if err != nil {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+func sendJobsRequest(req dmnsocket.Request) ([]Job, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := socket.SendRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	var resp JobsResponse
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	if req.Action != "jobs" && len(resp.Jobs) != 1 {
+		return nil, fmt.Errorf("job <%d>: unexpected response", req.Job)
+	}
+	return resp.Jobs, nil
+}
@@ -0,0 +1,282 @@
+package logfile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uwine4850/anthill/internal/pathutils"
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// RotatingFile is an append-only log file of a worker. The current file is
+// <dir>/<name>.log, rotated files are <dir>/<name>-<time>.log[.gz].
+type RotatingFile struct {
+	dir      string
+	name     string
+	cfg      dmnworker.LogConfig
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	openedAt time.Time
+	// compressing counts the rotated files that are compressed in the background,
+	// inCompress holds their paths so that prune does not remove them meanwhile.
+	compressing sync.WaitGroup
+	inCompress  map[string]bool
+}
+
+func Open(name string, cfg dmnworker.LogConfig) (*RotatingFile, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = config.LOG_MAX_SIZE
+	}
+	if cfg.Retain <= 0 {
+		cfg.Retain = config.LOG_RETAIN
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{dir: cfg.Dir, name: name, cfg: cfg, inCompress: map[string]bool{}}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	if r.size > 0 && r.cfg.MaxAge > 0 && time.Since(r.openedAt) > r.cfg.MaxAge {
+		if err := r.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func Path(dir string, name string) string {
+	return filepath.Join(dir, name+".log")
+}
+
+func (r *RotatingFile) WriteLine(line string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return os.ErrClosed
+	}
+	if r.size > 0 && (r.size+int64(len(line))+1 > r.cfg.MaxSize ||
+		(r.cfg.MaxAge > 0 && time.Since(r.openedAt) > r.cfg.MaxAge)) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := r.f.WriteString(line + "\n")
+	r.size += int64(n)
+	return err
+}
+
+// Close closes the current file and waits until the rotated files are compressed.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	if r.f == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	r.mu.Unlock()
+	r.compressing.Wait()
+	return err
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(Path(r.dir, r.name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	r.openedAt = time.Now()
+	if r.size > 0 {
+		r.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	rotated := filepath.Join(r.dir, fmt.Sprintf("%s-%s.log", r.name, time.Now().Format(rotatedTimeFormat)))
+	if err := os.Rename(Path(r.dir, r.name), rotated); err != nil {
+		return err
+	}
+	// The rotated file is compressed without holding up the writes to the new file.
+	// The files skipped by prune while they were compressed are removed afterwards.
+	if r.cfg.Compress {
+		r.inCompress[rotated] = true
+		r.compressing.Add(1)
+		go func() {
+			defer r.compressing.Done()
+			if err := compress(rotated); err != nil {
+				log.Printf("compress log %s: %s\n", rotated, err)
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.inCompress, rotated)
+			if err := r.prune(); err != nil {
+				log.Printf("prune logs of %s: %s\n", r.name, err)
+			}
+		}()
+	}
+	if err := r.prune(); err != nil {
+		log.Printf("prune logs of %s: %s\n", r.name, err)
+	}
+	return r.open()
+}
+
+// prune removes the oldest rotated files above the retention count, except the
+// files that are still compressed. It is called with r.mu held.
+func (r *RotatingFile) prune() error {
+	rotated, err := rotatedFiles(r.dir, r.name)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(rotated)-r.cfg.Retain; i++ {
+		if r.inCompress[strings.TrimSuffix(rotated[i], ".gz")] {
+			continue
+		}
+		if err := os.Remove(rotated[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress writes the file to a temporary file that is renamed to <path>.gz once
+// it is complete, so readers never see a partly compressed file.
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rotatedFiles returns the rotated files of the worker from the oldest to the newest.
+func rotatedFiles(dir string, name string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	prefix := name + "-"
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(fileName, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(fileName[len(prefix):], ".gz"), ".log")
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(dir, fileName))
+	}
+	sort.Strings(files)
+	// A file that was just compressed may still exist next to its compressed copy.
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		found[file] = true
+	}
+	files = slices.DeleteFunc(files, func(file string) bool {
+		return found[file+".gz"]
+	})
+	return files, nil
+}
+
+// ReadHistory calls fn for every line stored for the worker, from the oldest rotated file to the current one.
+func ReadHistory(dir string, name string, fn func(line string) error) error {
+	files, err := rotatedFiles(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := pathutils.Exists(Path(dir, name)); err == nil {
+		files = append(files, Path(dir, name))
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no logs of worker <%s> in %s", name, dir)
+	}
+	for _, file := range files {
+		if err := readFile(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var reader io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("read %s: %s", path, err)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	r := bufio.NewReader(reader)
+	for {
+		line, err := r.ReadString('\n')
+		if len(line) != 0 {
+			if err := fn(strings.TrimSuffix(line, "\n")); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
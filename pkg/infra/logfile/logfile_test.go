@@ -0,0 +1,140 @@
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open("web", dmnworker.LogConfig{Dir: dir, MaxSize: 64, Retain: 100, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{}
+	for i := 0; i < 50; i++ {
+		line := fmt.Sprintf("line %02d", i)
+		if err := r.WriteLine(line); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, line)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := 0
+	for _, entry := range entries {
+		switch name := entry.Name(); {
+		case name == "web.log":
+		case strings.HasSuffix(name, ".log.gz"):
+			compressed++
+		default:
+			t.Errorf("unexpected file %s after close", name)
+		}
+	}
+	if compressed == 0 {
+		t.Fatal("no rotated file was compressed")
+	}
+
+	got := []string{}
+	err = ReadHistory(dir, "web", func(line string) error {
+		got = append(got, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("history = %v, want %v", got, want)
+	}
+}
+
+func TestRotatedFilesSkipsCompressedDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"web-20260101T000000.000000000.log",
+		"web-20260101T000000.000000000.log.gz",
+		"web-20260102T000000.000000000.log",
+		"web-20260103T000000.000000000.log.gz.tmp",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := rotatedFiles(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "web-20260101T000000.000000000.log.gz"),
+		filepath.Join(dir, "web-20260102T000000.000000000.log"),
+	}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("rotated files = %v, want %v", files, want)
+	}
+}
+
+func TestPruneSkipsFilesInCompress(t *testing.T) {
+	dir := t.TempDir()
+	r := &RotatingFile{dir: dir, name: "web", cfg: dmnworker.LogConfig{Dir: dir, Retain: 1}, inCompress: map[string]bool{}}
+	names := []string{
+		"web-20260101T000000.000000000.log",
+		"web-20260102T000000.000000000.log.gz",
+		"web-20260103T000000.000000000.log",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r.inCompress[filepath.Join(dir, names[0])] = true
+	if err := r.prune(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := rotatedFiles(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, names[0]), filepath.Join(dir, names[2])}
+	if strings.Join(files, ",") != strings.Join(want, ",") {
+		t.Fatalf("rotated files = %v, want %v", files, want)
+	}
+}
+
+func TestRotateCompressRetain(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open("web", dmnworker.LogConfig{Dir: dir, MaxSize: 64, Retain: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		if err := r.WriteLine(fmt.Sprintf("line %03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := rotatedFiles(dir, "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("rotated files = %v, want 2", files)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".log.gz") {
+			t.Fatalf("rotated file %s is not compressed", file)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package logsink
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// FileSink appends records as JSON lines to a file.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileSink(cfg dmnworker.SinkConfig) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(record dmnprocess.LogRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
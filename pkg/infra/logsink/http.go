@@ -0,0 +1,155 @@
+package logsink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// HTTPSink posts records in batches as a JSON array. A batch is sent when it is
+// full or when the flush interval passes, and is retried with a growing delay.
+// Records are dropped when the queue is full so the workers are never blocked.
+type HTTPSink struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	client        *http.Client
+	queue         chan dmnprocess.LogRecord
+	stop          chan struct{}
+	stopOnce      sync.Once
+	done          chan struct{}
+	dropped       atomic.Int64
+}
+
+func NewHTTPSink(cfg dmnworker.SinkConfig) *HTTPSink {
+	s := &HTTPSink{
+		url:           cfg.URL,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		retries:       cfg.Retries,
+		client:        &http.Client{Timeout: config.SINK_HTTP_TIMEOUT},
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = config.SINK_BATCH_SIZE
+	}
+	if s.flushInterval <= 0 {
+		s.flushInterval = config.SINK_FLUSH_INTERVAL
+	}
+	if s.retries < 0 {
+		s.retries = 0
+	}
+	s.queue = make(chan dmnprocess.LogRecord, s.batchSize*config.SINK_QUEUE_BATCHES)
+	go s.run()
+	return s
+}
+
+func (s *HTTPSink) Write(record dmnprocess.LogRecord) error {
+	select {
+	case <-s.stop:
+		return fmt.Errorf("http sink %s is closed", s.url)
+	default:
+	}
+	select {
+	case s.queue <- record:
+		return nil
+	default:
+		if s.dropped.Add(1)%int64(s.batchSize) == 1 {
+			return fmt.Errorf("http sink %s: queue is full, %d records dropped", s.url, s.dropped.Load())
+		}
+		return nil
+	}
+}
+
+// Close sends the queued records and stops the sink. The queue stays open, so a
+// concurrent Write never sends on a closed channel.
+func (s *HTTPSink) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+	batch := make([]dmnprocess.LogRecord, 0, s.batchSize)
+	for {
+		select {
+		case <-s.stop:
+			for {
+				select {
+				case record := <-s.queue:
+					batch = append(batch, record)
+					if len(batch) >= s.batchSize {
+						s.send(batch)
+						batch = make([]dmnprocess.LogRecord, 0, s.batchSize)
+					}
+				default:
+					s.send(batch)
+					return
+				}
+			}
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				s.send(batch)
+				batch = make([]dmnprocess.LogRecord, 0, s.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) != 0 {
+				s.send(batch)
+				batch = make([]dmnprocess.LogRecord, 0, s.batchSize)
+			}
+		}
+	}
+}
+
+func (s *HTTPSink) send(batch []dmnprocess.LogRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		log.Printf("http sink %s: %s\n", s.url, err)
+		return
+	}
+	delay := config.SINK_RETRY_DELAY
+	for attempt := 0; ; attempt++ {
+		err = s.post(data)
+		if err == nil {
+			return
+		}
+		if attempt >= s.retries {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+	log.Printf("http sink %s: %d records dropped: %s\n", s.url, len(batch), err)
+}
+
+func (s *HTTPSink) post(data []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
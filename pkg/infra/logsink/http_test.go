@@ -0,0 +1,137 @@
+package logsink
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// batchServer records the size of every batch it accepts. The first requests, up
+// to failures, are answered with an error.
+type batchServer struct {
+	mu       sync.Mutex
+	failures int
+	requests int
+	batches  []int
+}
+
+func (b *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var batch []dmnprocess.LogRecord
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.requests++
+	if b.requests <= b.failures {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	b.batches = append(b.batches, len(batch))
+}
+
+func (b *batchServer) result() (int, []int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.requests, append([]int(nil), b.batches...)
+}
+
+func TestHTTPSinkBatches(t *testing.T) {
+	backend := &batchServer{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	sink := NewHTTPSink(dmnworker.SinkConfig{Type: "http", URL: server.URL, BatchSize: 3, FlushInterval: time.Hour})
+	for i := 0; i < 7; i++ {
+		if err := sink.Write(dmnprocess.LogRecord{Line: "line"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, batches := backend.result()
+	if len(batches) != 3 || batches[0] != 3 || batches[1] != 3 || batches[2] != 1 {
+		t.Fatalf("unexpected batches %v", batches)
+	}
+	if err := sink.Write(dmnprocess.LogRecord{Line: "late"}); err == nil {
+		t.Fatal("expected an error from a write to a closed sink")
+	}
+}
+
+func TestHTTPSinkFlushInterval(t *testing.T) {
+	backend := &batchServer{}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	sink := NewHTTPSink(dmnworker.SinkConfig{Type: "http", URL: server.URL, BatchSize: 100, FlushInterval: 50 * time.Millisecond})
+	defer sink.Close()
+	sink.Write(dmnprocess.LogRecord{Line: "line"})
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, batches := backend.result(); len(batches) == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("the batch was not sent at the flush interval")
+}
+
+func TestHTTPSinkRetry(t *testing.T) {
+	backend := &batchServer{failures: 1}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	sink := NewHTTPSink(dmnworker.SinkConfig{Type: "http", URL: server.URL, BatchSize: 2, FlushInterval: time.Hour, Retries: 1})
+	sink.Write(dmnprocess.LogRecord{Line: "a"})
+	sink.Write(dmnprocess.LogRecord{Line: "b"})
+	sink.Close()
+	requests, batches := backend.result()
+	if requests != 2 || len(batches) != 1 || batches[0] != 2 {
+		t.Fatalf("expected one retried batch, got %d requests and batches %v", requests, batches)
+	}
+}
+
+func TestHTTPSinkRetriesExhausted(t *testing.T) {
+	backend := &batchServer{failures: 10}
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	sink := NewHTTPSink(dmnworker.SinkConfig{Type: "http", URL: server.URL, BatchSize: 1, FlushInterval: time.Hour})
+	sink.Write(dmnprocess.LogRecord{Line: "a"})
+	sink.Close()
+	requests, batches := backend.result()
+	if requests != 1 || len(batches) != 0 {
+		t.Fatalf("expected one dropped batch, got %d requests and batches %v", requests, batches)
+	}
+}
+
+func TestReleaseClosesUnusedSink(t *testing.T) {
+	cfg := dmnworker.SinkConfig{Type: "file", Path: t.TempDir() + "/sink.jsonl"}
+	first, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Fatal("sinks of the same config are not shared")
+	}
+	Release(first)
+	if err := second.Write(dmnprocess.LogRecord{Line: "a"}); err != nil {
+		t.Fatalf("sink closed while still held: %s", err)
+	}
+	Release(second)
+	if err := second.Write(dmnprocess.LogRecord{Line: "b"}); err == nil {
+		t.Fatal("expected the released sink to be closed")
+	}
+}
@@ -0,0 +1,90 @@
+package logsink
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+type openSink struct {
+	sink dmnprocess.LogSink
+	refs int
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]*openSink{}
+)
+
+// Open returns the sink for the config. Sinks are shared by all workers with the
+// same config and live until the last of them releases it, so a worker restart
+// does not lose batched records.
+func Open(cfg dmnworker.SinkConfig) (dmnprocess.LogSink, error) {
+	key, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if open, ok := sinks[string(key)]; ok {
+		open.refs++
+		return open.sink, nil
+	}
+	sink, err := newSink(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sinks[string(key)] = &openSink{sink: sink, refs: 1}
+	return sink, nil
+}
+
+// Release closes the sink once no worker holds it anymore. A sink that a reload
+// removed is closed with the last worker that still uses it.
+func Release(sink dmnprocess.LogSink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for key, open := range sinks {
+		if open.sink != sink {
+			continue
+		}
+		open.refs--
+		if open.refs <= 0 {
+			if err := sink.Close(); err != nil {
+				log.Printf("close sink: %s\n", err)
+			}
+			delete(sinks, key)
+		}
+		return
+	}
+}
+
+func newSink(cfg dmnworker.SinkConfig) (dmnprocess.LogSink, error) {
+	switch cfg.Type {
+	case "syslog":
+		return NewSyslogSink(cfg)
+	case "file":
+		return NewFileSink(cfg)
+	case "http":
+		return NewHTTPSink(cfg), nil
+	case "stdout":
+		return NewStdoutSink(), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type <%s>", cfg.Type)
+	}
+}
+
+// CloseAll flushes and closes every open sink.
+func CloseAll() {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for key, open := range sinks {
+		if err := open.sink.Close(); err != nil {
+			log.Printf("close sink: %s\n", err)
+		}
+		delete(sinks, key)
+	}
+}
@@ -0,0 +1,33 @@
+package logsink
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+)
+
+var stdoutMu sync.Mutex
+
+// StdoutSink writes records as JSON lines to the orchestrator stdout, for container deployments.
+type StdoutSink struct{}
+
+func NewStdoutSink() *StdoutSink {
+	return &StdoutSink{}
+}
+
+func (s *StdoutSink) Write(record dmnprocess.LogRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	stdoutMu.Lock()
+	defer stdoutMu.Unlock()
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package logsink
+
+import (
+	"log/syslog"
+	"strings"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// SyslogSink writes records to the local syslog socket, or to the unix socket in Address.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogSink(cfg dmnworker.SinkConfig) (*SyslogSink, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "anthill"
+	}
+	network := ""
+	if cfg.Address != "" {
+		network = "unixgram"
+	}
+	writer, err := syslog.Dial(network, cfg.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+func (s *SyslogSink) Write(record dmnprocess.LogRecord) error {
+	message := record.Worker + ": " + record.Line
+	switch strings.ToLower(record.Level) {
+	case "debug", "trace":
+		return s.writer.Debug(message)
+	case "warn", "warning":
+		return s.writer.Warning(message)
+	case "error", "err", "fatal", "panic", "critical":
+		return s.writer.Err(message)
+	}
+	if record.Stream == dmnprocess.STREAM_STDERR {
+		return s.writer.Err(message)
+	}
+	return s.writer.Info(message)
+}
+
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DURATION_BUCKETS are the upper bounds in seconds of the duration histograms.
+var DURATION_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Writer writes metrics in the Prometheus text exposition format.
+type Writer struct {
+	w   io.Writer
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Family starts a metric family. kind is counter, gauge or histogram.
+func (w *Writer) Family(name string, kind string, help string) {
+	w.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes one sample of the current family. labels are name and value pairs.
+func (w *Writer) Sample(name string, value float64, labels ...string) {
+	w.printf("%s%s %s\n", name, formatLabels(labels), formatValue(value))
+}
+
+func (w *Writer) Err() error {
+	return w.err
+}
+
+func (w *Writer) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"="+strconv.Quote(labels[i+1]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// HistogramVec is a histogram partitioned by the value of one label.
+type HistogramVec struct {
+	mu         sync.Mutex
+	label      string
+	buckets    []float64
+	histograms map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewHistogramVec(label string, buckets []float64) *HistogramVec {
+	return &HistogramVec{
+		label:      label,
+		buckets:    buckets,
+		histograms: make(map[string]*histogram),
+	}
+}
+
+func (h *HistogramVec) Observe(labelValue string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist, ok := h.histograms[labelValue]
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.histograms[labelValue] = hist
+	}
+	for i := 0; i < len(h.buckets); i++ {
+		if value <= h.buckets[i] {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += value
+}
+
+// Write writes the samples of the histogram family name.
+func (h *HistogramVec) Write(w *Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, labelValue := range sortedKeys(h.histograms) {
+		hist := h.histograms[labelValue]
+		for i := 0; i < len(h.buckets); i++ {
+			w.Sample(name+"_bucket", float64(hist.counts[i]), h.label, labelValue, "le", formatValue(h.buckets[i]))
+		}
+		w.Sample(name+"_bucket", float64(hist.count), h.label, labelValue, "le", "+Inf")
+		w.Sample(name+"_sum", hist.sum, h.label, labelValue)
+		w.Sample(name+"_count", float64(hist.count), h.label, labelValue)
+	}
+}
+
+// CounterVec is a counter partitioned by the value of one label.
+type CounterVec struct {
+	mu       sync.Mutex
+	label    string
+	counters map[string]float64
+}
+
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{
+		label:    label,
+		counters: make(map[string]float64),
+	}
+}
+
+func (c *CounterVec) Inc(labelValue string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters[labelValue]++
+}
+
+// Write writes the samples of the counter family name.
+func (c *CounterVec) Write(w *Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, labelValue := range sortedKeys(c.counters) {
+		w.Sample(name, c.counters[labelValue], c.label, labelValue)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
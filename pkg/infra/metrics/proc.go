@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AT_CLKTCK is the entry of the auxiliary vector that holds the USER_HZ unit of
+// the times in /proc/<pid>/stat, which sysconf(_SC_CLK_TCK) returns.
+const AT_CLKTCK = 17
+
+// DEFAULT_CLOCK_TICKS is used if the auxiliary vector cannot be read.
+const DEFAULT_CLOCK_TICKS = 100
+
+var clockTicks = sync.OnceValue(func() float64 {
+	data, err := os.ReadFile("/proc/self/auxv")
+	if err != nil {
+		return DEFAULT_CLOCK_TICKS
+	}
+	// The vector is a list of key and value pairs of native words.
+	const word = strconv.IntSize / 8
+	for i := 0; i+2*word <= len(data); i += 2 * word {
+		key, value := readWord(data[i:]), readWord(data[i+word:])
+		if key == AT_CLKTCK && value > 0 {
+			return float64(value)
+		}
+	}
+	return DEFAULT_CLOCK_TICKS
+})
+
+func readWord(b []byte) uint64 {
+	if strconv.IntSize == 32 {
+		return uint64(binary.NativeEndian.Uint32(b))
+	}
+	return binary.NativeEndian.Uint64(b)
+}
+
+type ProcStats struct {
+	CPUSeconds float64
+	RSSBytes   int64
+}
+
+type procStat struct {
+	ppid  int
+	ticks uint64
+	rss   int64
+}
+
+// ReadProc reads the CPU time and resident memory of the process from /proc and
+// adds those of its descendants in the tree. The CPU time includes the children
+// that already exited.
+func ReadProc(pid int, tree ProcessTree) (*ProcStats, error) {
+	root, err := readStat(pid)
+	if err != nil {
+		return nil, err
+	}
+	stats := &ProcStats{}
+	add := func(s *procStat) {
+		stats.CPUSeconds += float64(s.ticks) / clockTicks()
+		stats.RSSBytes += s.rss * int64(os.Getpagesize())
+	}
+	add(root)
+	queue := tree[pid]
+	for i := 0; i < len(queue); i++ {
+		add(queue[i].stat)
+		queue = append(queue, tree[queue[i].pid]...)
+	}
+	return stats, nil
+}
+
+type childProcess struct {
+	pid  int
+	stat *procStat
+}
+
+// ProcessTree holds the processes of /proc by their parent. It is read once and
+// shared by the ReadProc calls of a scrape.
+type ProcessTree map[int][]childProcess
+
+// ReadProcessTree reads every process of /proc. Processes that exit while /proc is
+// read are left out.
+func ReadProcessTree() ProcessTree {
+	children := make(ProcessTree)
+	dirs, err := filepath.Glob("/proc/[0-9]*")
+	if err != nil {
+		return children
+	}
+	for i := 0; i < len(dirs); i++ {
+		pid, err := strconv.Atoi(filepath.Base(dirs[i]))
+		if err != nil {
+			continue
+		}
+		stat, err := readStat(pid)
+		if err != nil {
+			continue
+		}
+		children[stat.ppid] = append(children[stat.ppid], childProcess{pid: pid, stat: stat})
+	}
+	return children
+}
+
+func readStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// The command name may contain spaces, the fields are counted after it.
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// ppid is the field 4 of the stat, utime, stime, cutime and cstime are the fields
+	// 14 to 17 and rss is the field 24, the state is field 3.
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	var ticks uint64
+	for i := 11; i <= 14; i++ {
+		t, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ticks += uint64(max(t, 0))
+	}
+	rss, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &procStat{ppid: ppid, ticks: ticks, rss: rss}, nil
+}
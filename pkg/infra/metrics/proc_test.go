@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestClockTicks(t *testing.T) {
+	if ticks := clockTicks(); ticks <= 0 {
+		t.Fatalf("clock ticks = %v", ticks)
+	}
+}
+
+func TestReadProcIncludesChildren(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & sleep 30 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	var children []childProcess
+	for deadline := time.Now().Add(5 * time.Second); len(children) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("sleep processes not started, children: %v", children)
+		}
+		time.Sleep(10 * time.Millisecond)
+		children = ReadProcessTree()[cmd.Process.Pid]
+	}
+
+	root, err := readStat(cmd.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := ReadProc(cmd.Process.Pid, ReadProcessTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.RSSBytes <= root.rss*int64(os.Getpagesize()) {
+		t.Fatalf("rss %d does not include the children, the shell alone has %d", stats.RSSBytes, root.rss*int64(os.Getpagesize()))
+	}
+
+	own, err := ReadProc(cmd.Process.Pid, ProcessTree{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if own.RSSBytes >= stats.RSSBytes {
+		t.Fatalf("rss %d without the tree is not below %d with it", own.RSSBytes, stats.RSSBytes)
+	}
+}
@@ -0,0 +1,119 @@
+package outputs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/uwine4850/anthill/pkg/config"
+)
+
+// The outputs of a worker are the files of its outputs directory. The name of a file
+// is the key of the output and its content the value. The directory is passed to the
+// worker in ANTHILL_OUTPUTS_DIR and emptied before the worker starts. The parallel runs
+// of a job after the first have a directory of their own, named name#slot.
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+var referencePattern = regexp.MustCompile(`\$\{steps\.([^.}]+)\.outputs\.([^}]+)\}`)
+
+// Dir returns the absolute outputs directory of the worker.
+func Dir(worker string) (string, error) {
+	return filepath.Abs(filepath.Join(config.OUTPUTS_DIR, worker))
+}
+
+// Reset removes the outputs of the previous run of the worker.
+func Reset(worker string) error {
+	dir, err := Dir(worker)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0700)
+}
+
+// Set publishes an output of the running worker.
+func Set(key string, value string) error {
+	dir := os.Getenv(config.ENV_OUTPUTS_DIR)
+	if dir == "" {
+		return fmt.Errorf("%s is not set", config.ENV_OUTPUTS_DIR)
+	}
+	return Write(dir, key, value)
+}
+
+// Write stores the output in the directory. The value is written to a temporary
+// file first, so a reader never sees a partial value.
+func Write(dir string, key string, value string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid output key <%s>", key)
+	}
+	tmp, err := os.CreateTemp(dir, "."+key+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(value); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, key))
+}
+
+// Read returns the outputs of the worker. A trailing newline of a value is removed.
+func Read(worker string) (map[string]string, error) {
+	dir, err := Dir(worker)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !keyPattern.MatchString(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		values[entry.Name()] = strings.TrimSuffix(string(data), "\n")
+	}
+	return values, nil
+}
+
+// Resolve replaces the ${steps.<step>.outputs.<key>} references in s. lookup returns
+// the outputs of a step.
+func Resolve(s string, lookup func(step string) (map[string]string, error)) (string, error) {
+	var resolveErr error
+	resolved := referencePattern.ReplaceAllStringFunc(s, func(reference string) string {
+		if resolveErr != nil {
+			return reference
+		}
+		match := referencePattern.FindStringSubmatch(reference)
+		values, err := lookup(match[1])
+		if err != nil {
+			resolveErr = err
+			return reference
+		}
+		value, ok := values[match[2]]
+		if !ok {
+			resolveErr = fmt.Errorf("%s: step <%s> has no output <%s>", reference, match[1], match[2])
+			return reference
+		}
+		return value
+	})
+	return resolved, resolveErr
+}
@@ -0,0 +1,218 @@
+package parsecnf
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uwine4850/anthill/internal/pathutils"
+	"github.com/uwine4850/anthill/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// OrchestratorConfig configures the orchestrator daemon itself. The file is
+// optional, without it every extra listener is disabled.
+type OrchestratorConfig struct {
+	Metrics   MetricsConfig
+	API       APIConfig
+	Socket    SocketConfig
+	TLS       TLSConfig
+	Audit     AuditConfig
+	Limits    LimitsConfig
+	Pipelines PipelinesConfig
+	// Auth enables access control when it is set. Without it every client is an admin.
+	Auth *AuthConfig
+}
+
+type MetricsConfig struct {
+	// Address is the host:port of the HTTP listener serving /metrics.
+	Address string
+}
+
+type APIConfig struct {
+	// Address is the host:port of the HTTP listener serving the REST API.
+	Address string
+}
+
+// SocketConfig sets the permissions of the orchestrator socket file.
+type SocketConfig struct {
+	// Mode is the octal file mode, e.g. "0660".
+	Mode  string
+	Group string
+}
+
+// TLSConfig enables the TCP listener speaking the socket protocol over TLS.
+// Clients must present a certificate signed by ClientCA.
+type TLSConfig struct {
+	Address  string
+	Cert     string
+	Key      string
+	ClientCA string `yaml:"client_ca"`
+}
+
+// LimitsConfig protects the control socket and the TLS listener from slow and
+// excessive clients.
+type LimitsConfig struct {
+	MaxConnections  int           `yaml:"max_connections"`
+	MaxRequestBytes int64         `yaml:"max_request_bytes"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+}
+
+// AuditConfig sets the file every control action is appended to. The entries are
+// chained with an HMAC whose key is read from KeyFile, by default the path with a
+// .key suffix. The key must not be readable by those who can write the log.
+type AuditConfig struct {
+	Path     string
+	KeyFile  string `yaml:"key_file"`
+	Disabled bool
+}
+
+// PipelinesConfig sets the file the finished pipeline runs are appended to.
+type PipelinesConfig struct {
+	History string
+}
+
+// AuthConfig maps unix socket peers, TLS client certificates and HTTP tokens to roles.
+// Users and groups are matched by name or numeric id, subjects by the common name
+// of the certificate. Root and the user of the daemon are always admins.
+type AuthConfig struct {
+	DefaultRole string `yaml:"default_role"`
+	Users       []RoleBinding
+	Groups      []RoleBinding
+	Subjects    []RoleBinding
+	Tokens      []TokenConfig
+}
+
+type RoleBinding struct {
+	Name string
+	Role string
+}
+
+type TokenConfig struct {
+	Name      string
+	Token     string
+	TokenFile string `yaml:"token_file"`
+	Role      string
+}
+
+// DefaultOrchestratorConfig is the config used without a config file.
+func DefaultOrchestratorConfig() *OrchestratorConfig {
+	return &OrchestratorConfig{
+		Audit:     AuditConfig{Path: config.AUDIT_LOG_PATH},
+		Pipelines: PipelinesConfig{History: config.PIPELINE_HISTORY_PATH},
+		Limits: LimitsConfig{
+			MaxConnections:  config.MAX_CONNECTIONS,
+			MaxRequestBytes: config.MAX_REQUEST_BYTES,
+			ReadTimeout:     config.REQUEST_READ_TIMEOUT,
+			WriteTimeout:    config.RESPONSE_WRITE_TIMEOUT,
+		},
+	}
+}
+
+func ParseOrchestrator(configPath string) (*OrchestratorConfig, error) {
+	orchestratorConfig := DefaultOrchestratorConfig()
+	f, err := os.ReadFile(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return orchestratorConfig, nil
+		}
+		return nil, err
+	}
+	if err := yaml.Unmarshal(f, orchestratorConfig); err != nil {
+		return nil, err
+	}
+	if err := validateLimits(&orchestratorConfig.Limits); err != nil {
+		return nil, err
+	}
+	addresses := []string{orchestratorConfig.Metrics.Address, orchestratorConfig.API.Address, orchestratorConfig.TLS.Address}
+	for i := 0; i < len(addresses); i++ {
+		if addresses[i] == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addresses[i]); err != nil {
+			return nil, err
+		}
+	}
+	if orchestratorConfig.Socket.Mode != "" {
+		if _, err := strconv.ParseUint(orchestratorConfig.Socket.Mode, 8, 32); err != nil {
+			return nil, fmt.Errorf("invalid socket mode <%s>", orchestratorConfig.Socket.Mode)
+		}
+	}
+	if err := validateTLS(&orchestratorConfig.TLS); err != nil {
+		return nil, err
+	}
+	if orchestratorConfig.Auth != nil {
+		// The roles of socket peers are read from their credentials, which are only available on linux.
+		if runtime.GOOS != "linux" {
+			return nil, fmt.Errorf("auth is not supported on %s", runtime.GOOS)
+		}
+		if err := validateAuth(orchestratorConfig.Auth); err != nil {
+			return nil, err
+		}
+	}
+	return orchestratorConfig, nil
+}
+
+func validateLimits(limits *LimitsConfig) error {
+	if limits.MaxConnections <= 0 || limits.MaxRequestBytes <= 0 {
+		return fmt.Errorf("max_connections and max_request_bytes must be positive")
+	}
+	if limits.ReadTimeout <= 0 || limits.WriteTimeout <= 0 {
+		return fmt.Errorf("read_timeout and write_timeout must be positive")
+	}
+	return nil
+}
+
+func validateTLS(tlsConfig *TLSConfig) error {
+	if tlsConfig.Address == "" {
+		return nil
+	}
+	files := []string{tlsConfig.Cert, tlsConfig.Key, tlsConfig.ClientCA}
+	for i := 0; i < len(files); i++ {
+		if files[i] == "" {
+			return fmt.Errorf("tls listener requires cert, key and client_ca")
+		}
+		if err := pathutils.Exists(files[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var roles = []string{"viewer", "operator", "admin"}
+
+// validateAuth checks the roles and reads the token files.
+func validateAuth(authConfig *AuthConfig) error {
+	if authConfig.DefaultRole != "" && authConfig.DefaultRole != "none" && !slices.Contains(roles, authConfig.DefaultRole) {
+		return fmt.Errorf("unknown default role <%s>", authConfig.DefaultRole)
+	}
+	bindings := slices.Concat(authConfig.Users, authConfig.Groups, authConfig.Subjects)
+	for i := 0; i < len(bindings); i++ {
+		if !slices.Contains(roles, bindings[i].Role) {
+			return fmt.Errorf("unknown role <%s> of <%s>", bindings[i].Role, bindings[i].Name)
+		}
+	}
+	for i := 0; i < len(authConfig.Tokens); i++ {
+		token := &authConfig.Tokens[i]
+		if !slices.Contains(roles, token.Role) {
+			return fmt.Errorf("unknown role <%s> of token <%s>", token.Role, token.Name)
+		}
+		if token.TokenFile != "" {
+			data, err := os.ReadFile(token.TokenFile)
+			if err != nil {
+				return err
+			}
+			token.Token = strings.TrimSpace(string(data))
+		}
+		if token.Token == "" {
+			return fmt.Errorf("token <%s> is empty", token.Name)
+		}
+	}
+	return nil
+}
@@ -27,9 +27,29 @@ func ParsePlugins(configPath string) (*dmnworker.PluginsConfig, error) {
 	if err := checkPluginsPath(pluginsConfig.Plugins); err != nil {
 		return nil, err
 	}
+	if err := checkPluginDirs(pluginsConfig.PluginDirs); err != nil {
+		return nil, err
+	}
 	return &pluginsConfig, nil
 }
 
+// checkPluginDirs allows missing directories so that optional system paths can be listed.
+func checkPluginDirs(dirs []string) error {
+	for i := 0; i < len(dirs); i++ {
+		isFile, err := pathutils.IsFile(dirs[i])
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if isFile {
+			return fmt.Errorf("plugin dir %s must be a directory", dirs[i])
+		}
+	}
+	return nil
+}
+
 func checkPluginsPath(workers []string) error {
 	for i := 0; i < len(workers); i++ {
 		if err := pathutils.Exists(workers[i]); err != nil {
@@ -42,8 +62,15 @@ func checkPluginsPath(workers []string) error {
 		if !isFile {
 			return fmt.Errorf("plugin %s must be a file", workers[i])
 		}
-		if filepath.Ext(workers[i]) != ".so" {
-			return fmt.Errorf("plugin %s must have .so extension", workers[i])
+		if filepath.Ext(workers[i]) == ".so" {
+			continue
+		}
+		info, err := os.Stat(workers[i])
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm()&0111 == 0 {
+			return fmt.Errorf("plugin %s must have .so extension or be executable", workers[i])
 		}
 	}
 	return nil
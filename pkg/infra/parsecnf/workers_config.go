@@ -4,14 +4,20 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strings"
 
 	"github.com/uwine4850/anthill/internal/pathutils"
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
 	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
 	"gopkg.in/yaml.v3"
 )
 
 type WorkersConfig struct {
-	Workers []dmnworker.WorkerConfig
+	Log       dmnworker.LogConfig
+	Sinks     []dmnworker.SinkConfig
+	Workers   []dmnworker.WorkerConfig
+	Pipelines []dmnworker.PipelineConfig
 }
 
 func ParseWorkers(configPath string) (*WorkersConfig, error) {
@@ -34,17 +40,44 @@ func ParseWorkers(configPath string) (*WorkersConfig, error) {
 	if err := validateAfterList(&workersConfig); err != nil {
 		return nil, err
 	}
+	if err := validateLabels(&workersConfig); err != nil {
+		return nil, err
+	}
+	if err := validateKinds(&workersConfig); err != nil {
+		return nil, err
+	}
+	if err := validateReadiness(&workersConfig); err != nil {
+		return nil, err
+	}
+	if err := validateSinks(&workersConfig); err != nil {
+		return nil, err
+	}
+	if err := validatePipelines(&workersConfig); err != nil {
+		return nil, err
+	}
+	if err := validateLogConfigs(&workersConfig); err != nil {
+		return nil, err
+	}
+	applyGlobalDefaults(&workersConfig)
 	return &workersConfig, nil
 }
 
 func validateNames(workersConfig *WorkersConfig) error {
 	seen := make(map[string]struct{}, len(workersConfig.Workers))
 	for i := 0; i < len(workersConfig.Workers); i++ {
-		name := workersConfig.Workers[i].Name
-		if _, ok := seen[name]; ok {
-			return fmt.Errorf("worker <%s> already exists", name)
-		} else {
-			seen[name] = struct{}{}
+		if workersConfig.Workers[i].Replicas < 0 {
+			return fmt.Errorf("worker <%s> has a negative number of replicas", workersConfig.Workers[i].Name)
+		}
+		names := []string{workersConfig.Workers[i].Name}
+		if workersConfig.Workers[i].Replicas > 0 {
+			names = append(names, dmnworker.InstanceNames(workersConfig.Workers[i])...)
+		}
+		for _, name := range names {
+			if _, ok := seen[name]; ok {
+				return fmt.Errorf("worker <%s> already exists", name)
+			} else {
+				seen[name] = struct{}{}
+			}
 		}
 	}
 	return nil
@@ -63,6 +96,261 @@ func validateAfterList(workersConfig *WorkersConfig) error {
 					workersConfig.Workers[i].Name, after)
 			}
 		}
+		for j := 0; j < len(workersConfig.Workers[i].AfterReady); j++ {
+			after := workersConfig.Workers[i].AfterReady[j]
+			if !slices.Contains(workersNames, after) {
+				return fmt.Errorf("the after_ready field of the worker <%s> contains a non-existent worker <%s>",
+					workersConfig.Workers[i].Name, after)
+			}
+		}
+	}
+	return nil
+}
+
+func validateLabels(workersConfig *WorkersConfig) error {
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		for key := range workersConfig.Workers[i].Labels {
+			if key == "name" || key == "group" {
+				return fmt.Errorf("the label <%s> of the worker <%s> is reserved", key, workersConfig.Workers[i].Name)
+			}
+			if key == "" || strings.ContainsAny(key, ",=! ") {
+				return fmt.Errorf("the worker <%s> has an invalid label <%s>", workersConfig.Workers[i].Name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// applyGlobalDefaults fills the unset log fields of every worker from the global
+// log config and prepends the global sinks to the sinks of the worker.
+func applyGlobalDefaults(workersConfig *WorkersConfig) {
+	global := workersConfig.Log
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		logConfig := &workersConfig.Workers[i].Log
+		if logConfig.Dir == "" {
+			logConfig.Dir = global.Dir
+		}
+		if logConfig.MaxSize == 0 {
+			logConfig.MaxSize = global.MaxSize
+		}
+		if logConfig.MaxAge == 0 {
+			logConfig.MaxAge = global.MaxAge
+		}
+		if !logConfig.Compress {
+			logConfig.Compress = global.Compress
+		}
+		if logConfig.Retain == 0 {
+			logConfig.Retain = global.Retain
+		}
+		if logConfig.HistoryLines == 0 {
+			logConfig.HistoryLines = global.HistoryLines
+		}
+		if logConfig.MaxLineBytes == 0 {
+			logConfig.MaxLineBytes = global.MaxLineBytes
+		}
+		if logConfig.Overflow == "" {
+			logConfig.Overflow = global.Overflow
+		}
+		workersConfig.Workers[i].Sinks = append(slices.Clone(workersConfig.Sinks), workersConfig.Workers[i].Sinks...)
+	}
+}
+
+// validateKinds checks the job config of job workers and makes service the default kind.
+func validateKinds(workersConfig *WorkersConfig) error {
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		w := &workersConfig.Workers[i]
+		switch w.Kind {
+		case "":
+			w.Kind = dmnworker.KIND_SERVICE
+			fallthrough
+		case dmnworker.KIND_SERVICE:
+			if w.Job != (dmnworker.JobConfig{}) {
+				return fmt.Errorf("the worker <%s> has a job config but is not of kind job", w.Name)
+			}
+		case dmnworker.KIND_JOB:
+			if w.Reload {
+				return fmt.Errorf("the job worker <%s> cannot reload, set job retries instead", w.Name)
+			}
+			if w.Job.Completions < 0 || w.Job.Parallelism < 0 || w.Job.Retries < 0 || w.Job.ActiveDeadline < 0 {
+				return fmt.Errorf("the job config of <%s> must not be negative", w.Name)
+			}
+		default:
+			return fmt.Errorf("the worker <%s> has an unknown kind <%s>", w.Name, w.Kind)
+		}
+	}
+	return nil
+}
+
+// validateReadiness checks that every service has at most one readiness probe and
+// fills the unset interval and timeout of the probe.
+func validateReadiness(workersConfig *WorkersConfig) error {
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		w := &workersConfig.Workers[i]
+		if !w.Readiness.IsSet() {
+			continue
+		}
+		if w.Kind == dmnworker.KIND_JOB {
+			return fmt.Errorf("the job worker <%s> cannot have a readiness probe", w.Name)
+		}
+		probes := 0
+		for _, set := range []bool{w.Readiness.TCP != "", w.Readiness.HTTP != "", len(w.Readiness.Exec) > 0} {
+			if set {
+				probes++
+			}
+		}
+		if probes > 1 {
+			return fmt.Errorf("the readiness of <%s> must set only one of tcp, http and exec", w.Name)
+		}
+		if w.Readiness.Interval < 0 || w.Readiness.Timeout < 0 {
+			return fmt.Errorf("the readiness of <%s> must not be negative", w.Name)
+		}
+		if w.Readiness.Interval == 0 {
+			w.Readiness.Interval = config.READINESS_INTERVAL
+		}
+		if w.Readiness.Timeout == 0 {
+			w.Readiness.Timeout = config.READINESS_TIMEOUT
+		}
+	}
+	return nil
+}
+
+// validatePipelines names the unnamed steps after their worker and checks that the
+// steps of every pipeline reference existing workers and steps without a cycle.
+func validatePipelines(workersConfig *WorkersConfig) error {
+	workers := make(map[string]dmnworker.WorkerConfig, len(workersConfig.Workers))
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		workers[workersConfig.Workers[i].Name] = workersConfig.Workers[i]
+	}
+	pipelines := map[string]struct{}{}
+	for i := 0; i < len(workersConfig.Pipelines); i++ {
+		p := &workersConfig.Pipelines[i]
+		if p.Name == "" {
+			return fmt.Errorf("pipeline %d has no name", i+1)
+		}
+		if _, ok := pipelines[p.Name]; ok {
+			return fmt.Errorf("pipeline <%s> already exists", p.Name)
+		}
+		pipelines[p.Name] = struct{}{}
+		if len(p.Steps) == 0 {
+			return fmt.Errorf("pipeline <%s> has no steps", p.Name)
+		}
+		steps := map[string]int{}
+		for j := 0; j < len(p.Steps); j++ {
+			step := &p.Steps[j]
+			if step.Name == "" {
+				step.Name = step.Worker
+			}
+			w, ok := workers[step.Worker]
+			if !ok {
+				return fmt.Errorf("the step <%s> of pipeline <%s> references a non-existent worker <%s>", step.Name, p.Name, step.Worker)
+			}
+			if w.Replicas > 0 {
+				return fmt.Errorf("the step <%s> of pipeline <%s> references the worker <%s> with replicas", step.Name, p.Name, step.Worker)
+			}
+			if _, ok := steps[step.Name]; ok {
+				return fmt.Errorf("the step <%s> of pipeline <%s> already exists", step.Name, p.Name)
+			}
+			steps[step.Name] = j
+		}
+		for j := 0; j < len(p.Steps); j++ {
+			for _, after := range p.Steps[j].After {
+				if _, ok := steps[after]; !ok {
+					return fmt.Errorf("the step <%s> of pipeline <%s> is after a non-existent step <%s>", p.Steps[j].Name, p.Name, after)
+				}
+			}
+		}
+		if cycle := stepCycle(p.Steps, steps); cycle != "" {
+			return fmt.Errorf("pipeline <%s> has a step cycle %s", p.Name, cycle)
+		}
+	}
+	return nil
+}
+
+// stepCycle returns the steps of a cycle joined by arrows, or an empty string.
+func stepCycle(steps []dmnworker.StepConfig, index map[string]int) string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(steps))
+	var visit func(i int, path []string) string
+	visit = func(i int, path []string) string {
+		path = append(path, steps[i].Name)
+		switch state[i] {
+		case visiting:
+			return strings.Join(path, " -> ")
+		case visited:
+			return ""
+		}
+		state[i] = visiting
+		for _, after := range steps[i].After {
+			if cycle := visit(index[after], path); cycle != "" {
+				return cycle
+			}
+		}
+		state[i] = visited
+		return ""
+	}
+	for i := 0; i < len(steps); i++ {
+		if cycle := visit(i, nil); cycle != "" {
+			return cycle
+		}
+	}
+	return ""
+}
+
+func validateSinks(workersConfig *WorkersConfig) error {
+	if err := validateSinkList("global", workersConfig.Sinks); err != nil {
+		return err
+	}
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		if err := validateSinkList(workersConfig.Workers[i].Name, workersConfig.Workers[i].Sinks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSinkList(owner string, sinks []dmnworker.SinkConfig) error {
+	for _, sink := range sinks {
+		switch sink.Type {
+		case "syslog", "stdout":
+		case "file":
+			if sink.Path == "" {
+				return fmt.Errorf("the file sink of <%s> has no path", owner)
+			}
+		case "http":
+			if sink.URL == "" {
+				return fmt.Errorf("the http sink of <%s> has no url", owner)
+			}
+		default:
+			return fmt.Errorf("the sink of <%s> has an unknown type <%s>", owner, sink.Type)
+		}
+	}
+	return nil
+}
+
+func validateLogConfigs(workersConfig *WorkersConfig) error {
+	if err := validateLogConfig("global", workersConfig.Log); err != nil {
+		return err
+	}
+	for i := 0; i < len(workersConfig.Workers); i++ {
+		if err := validateLogConfig(workersConfig.Workers[i].Name, workersConfig.Workers[i].Log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateLogConfig(owner string, logConfig dmnworker.LogConfig) error {
+	switch logConfig.Overflow {
+	case "", dmnprocess.OVERFLOW_TRUNCATE, dmnprocess.OVERFLOW_SPLIT:
+	default:
+		return fmt.Errorf("the log of <%s> has an unknown overflow policy <%s>", owner, logConfig.Overflow)
+	}
+	if logConfig.HistoryLines < 0 || logConfig.MaxLineBytes < 0 {
+		return fmt.Errorf("the log limits of <%s> must not be negative", owner)
 	}
 	return nil
 }
@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+type State string
+
+const (
+	STATE_PENDING   State = "pending"
+	STATE_RUNNING   State = "running"
+	STATE_SUCCEEDED State = "succeeded"
+	STATE_FAILED    State = "failed"
+	STATE_SKIPPED   State = "skipped"
+	// STATE_INTERRUPTED is a run, or a step, that was running when the orchestrator stopped.
+	STATE_INTERRUPTED State = "interrupted"
+)
+
+// Run is one run of a pipeline. The steps are in the order of the pipeline config.
+type Run struct {
+	ID       int       `json:"id"`
+	Pipeline string    `json:"pipeline"`
+	State    State     `json:"state"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// ResumedFrom is the ID of the run whose succeeded steps this run reuses.
+	ResumedFrom int       `json:"resumed_from,omitempty"`
+	Steps       []StepRun `json:"steps"`
+}
+
+type StepRun struct {
+	Name     string        `json:"name"`
+	Worker   string        `json:"worker"`
+	State    State         `json:"state"`
+	Reused   bool          `json:"reused,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	ExitCode int           `json:"exit_code,omitempty"`
+	Error    string        `json:"error,omitempty"`
+
+	Outputs map[string]string `json:"outputs,omitempty"`
+}
+
+// NewRun returns a run of the pipeline with all steps pending.
+func NewRun(pipelineConfig dmnworker.PipelineConfig) Run {
+	run := Run{
+		Pipeline: pipelineConfig.Name,
+		State:    STATE_RUNNING,
+		Started:  time.Now(),
+		Steps:    make([]StepRun, len(pipelineConfig.Steps)),
+	}
+	for i := 0; i < len(pipelineConfig.Steps); i++ {
+		run.Steps[i] = StepRun{
+			Name:   pipelineConfig.Steps[i].Name,
+			Worker: pipelineConfig.Steps[i].Worker,
+			State:  STATE_PENDING,
+		}
+	}
+	return run
+}
+
+// Step returns the index of the step with the name, or -1.
+func (r *Run) Step(name string) int {
+	for i := 0; i < len(r.Steps); i++ {
+		if r.Steps[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Run) finished() bool {
+	return r.State == STATE_SUCCEEDED || r.State == STATE_FAILED || r.State == STATE_INTERRUPTED
+}
+
+// interrupt marks a run that was still running when it was read back as interrupted.
+func (r *Run) interrupt() {
+	if r.finished() {
+		return
+	}
+	r.State = STATE_INTERRUPTED
+	for i := 0; i < len(r.Steps); i++ {
+		switch r.Steps[i].State {
+		case STATE_RUNNING:
+			r.Steps[i].State = STATE_INTERRUPTED
+		case STATE_PENDING:
+			r.Steps[i].State = STATE_SKIPPED
+		}
+	}
+}
+
+// History keeps the runs of all pipelines. A run is appended to the history file when
+// it starts and again when it is finished, so IDs are never reused and the results
+// survive a restart of the orchestrator.
+type History struct {
+	mu   sync.Mutex
+	file *os.File
+	runs map[int]*Run
+	next int
+}
+
+// OpenHistory reads the runs of the file and opens it for appending. A run without
+// a finished record is interrupted. Without a path the history is kept in memory only.
+func OpenHistory(path string) (*History, error) {
+	h := &History{runs: make(map[int]*Run), next: 1}
+	if path == "" {
+		return h, nil
+	}
+	if err := h.read(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	h.file = file
+	return h, nil
+}
+
+func (h *History) read(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) != 0 {
+			var run Run
+			if jsonErr := json.Unmarshal(line, &run); jsonErr == nil {
+				h.runs[run.ID] = &run
+				h.next = max(h.next, run.ID+1)
+			} else if err == io.EOF {
+				// A torn last line of a crash is cut off, so the next record starts on a line of its own.
+				log.Printf("pipeline history %s: removed the unreadable last line: %s\n", path, jsonErr)
+				if err := os.Truncate(path, offset); err != nil {
+					return err
+				}
+			} else {
+				log.Printf("pipeline history %s: skipped an unreadable line: %s\n", path, jsonErr)
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, run := range h.runs {
+		run.interrupt()
+	}
+	return nil
+}
+
+// Add stores a new run, writes it to the history file and returns it with its ID.
+func (h *History) Add(run Run) (Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	run.ID = h.next
+	h.next++
+	h.runs[run.ID] = clone(run)
+	return run, h.write(run)
+}
+
+// Update stores the state of the run. A finished run is written to the history file.
+func (h *History) Update(run Run) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs[run.ID] = clone(run)
+	if !run.finished() {
+		return nil
+	}
+	return h.write(run)
+}
+
+func (h *History) write(run Run) error {
+	if h.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if _, err := h.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return h.file.Sync()
+}
+
+func (h *History) Get(id int) (Run, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	run, ok := h.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("pipeline run <%d> not exists", id)
+	}
+	return *clone(*run), nil
+}
+
+// List returns the runs of the pipeline, or of all pipelines, ordered by ID.
+func (h *History) List(pipeline string) []Run {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runs := []Run{}
+	for _, run := range h.runs {
+		if pipeline == "" || run.Pipeline == pipeline {
+			runs = append(runs, *clone(*run))
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].ID < runs[j].ID
+	})
+	return runs
+}
+
+func clone(run Run) *Run {
+	run.Steps = slices.Clone(run.Steps)
+	return &run
+}
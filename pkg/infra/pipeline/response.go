@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"errors"
+	"io"
+
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+)
+
+type PipelineResponse struct {
+	Runs  []Run
+	Error string
+}
+
+func SendPipelineResponse(w io.Writer, runs []Run, err error) error {
+	resp := PipelineResponse{Runs: runs}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return socket.SendRequest(w, &resp)
+}
+
+// RunPipeline starts a run of the pipeline and returns it.
+func RunPipeline(name string) (*Run, error) {
+	return sendRunRequest(dmnsocket.Request{Action: "pipeline_run", Name: name})
+}
+
+// ResumePipeline starts a run that reuses the succeeded steps of the run. It reruns
+// the step from and the steps after it, by default the first failed step.
+func ResumePipeline(id int, from string) (*Run, error) {
+	return sendRunRequest(dmnsocket.Request{Action: "pipeline_resume", Run: id, Step: from})
+}
+
+func GetRun(id int) (*Run, error) {
+	return sendRunRequest(dmnsocket.Request{Action: "pipeline_status", Run: id})
+}
+
+// ListRuns returns the runs of the pipeline, or of all pipelines without a name.
+func ListRuns(name string) ([]Run, error) {
+	return sendPipelineRequest(dmnsocket.Request{Action: "pipeline_status", Name: name})
+}
+
+func sendRunRequest(req dmnsocket.Request) (*Run, error) {
+	runs, err := sendPipelineRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) != 1 {
+		return nil, errors.New("unexpected pipeline response")
+	}
+	return &runs[0], nil
+}
+
+func sendPipelineRequest(req dmnsocket.Request) ([]Run, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := socket.SendRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	var resp PipelineResponse
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Runs, nil
+}
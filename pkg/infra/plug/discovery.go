@@ -0,0 +1,122 @@
+package plug
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uwine4850/anthill/internal/pathutils"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"gopkg.in/yaml.v3"
+)
+
+const MANIFEST_SUFFIX = ".plugin.yaml"
+
+const (
+	KIND_GO   = "go"
+	KIND_EXEC = "exec"
+)
+
+const (
+	SOURCE_CONFIG   = "config"
+	SOURCE_DIR      = "dir"
+	SOURCE_MANIFEST = "manifest"
+	SOURCE_BUILTIN  = "builtin"
+)
+
+// Discover collects the plugins listed in the config, found in the plugin
+// directories and the builtin plugins. Each plugin path appears only once.
+func Discover(pluginsConfig dmnworker.PluginsConfig) ([]dmnworker.PluginInfo, error) {
+	plugins := []dmnworker.PluginInfo{}
+	seen := map[string]struct{}{}
+	add := func(path string, source string, err error) {
+		if absPath, absErr := filepath.Abs(path); absErr == nil {
+			path = absPath
+		}
+		if _, ok := seen[path]; ok {
+			return
+		}
+		seen[path] = struct{}{}
+		info := dmnworker.PluginInfo{Path: path, Kind: pluginKind(path), Source: source}
+		if err != nil {
+			info.Error = err.Error()
+		}
+		plugins = append(plugins, info)
+	}
+
+	for i := 0; i < len(pluginsConfig.Plugins); i++ {
+		add(pluginsConfig.Plugins[i], SOURCE_CONFIG, nil)
+	}
+	for i := 0; i < len(pluginsConfig.PluginDirs); i++ {
+		if err := scanDir(pluginsConfig.PluginDirs[i], add); err != nil {
+			return nil, err
+		}
+	}
+	builtinList, err := BuiltinList()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(builtinList); i++ {
+		add(builtinList[i], SOURCE_BUILTIN, nil)
+	}
+	return plugins, nil
+}
+
+// scanDir adds the .so files and plugin manifests of the directory. A missing directory is ignored.
+func scanDir(dir string, add func(path string, source string, err error)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read plugin dir %s: %s", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		switch {
+		case filepath.Ext(entry.Name()) == ".so":
+			add(path, SOURCE_DIR, nil)
+		case strings.HasSuffix(entry.Name(), MANIFEST_SUFFIX):
+			execPath, err := readManifest(path)
+			if err != nil {
+				add(path, SOURCE_MANIFEST, err)
+				continue
+			}
+			add(execPath, SOURCE_MANIFEST, nil)
+		}
+	}
+	return nil
+}
+
+func readManifest(path string) (string, error) {
+	f, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var manifest dmnworker.PluginManifest
+	if err := yaml.Unmarshal(f, &manifest); err != nil {
+		return "", fmt.Errorf("manifest %s: %s", path, err)
+	}
+	if manifest.Exec == "" {
+		return "", fmt.Errorf("manifest %s has no exec field", path)
+	}
+	execPath := manifest.Exec
+	if !filepath.IsAbs(execPath) {
+		execPath = filepath.Join(filepath.Dir(path), execPath)
+	}
+	if err := pathutils.Exists(execPath); err != nil {
+		return "", fmt.Errorf("manifest %s: %s: %s", path, execPath, err)
+	}
+	return execPath, nil
+}
+
+func pluginKind(path string) string {
+	if IsExecPlugin(path) {
+		return KIND_EXEC
+	}
+	return KIND_GO
+}
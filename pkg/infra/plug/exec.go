@@ -0,0 +1,313 @@
+package plug
+
+// Executable plugins are ordinary programs that implement WorkerAnt over
+// JSON-RPC 2.0 on stdin/stdout. Every message is a single JSON object on its
+// own line. The orchestrator sends requests, the plugin answers each one with
+// a response carrying the same id:
+//
+//	-> {"jsonrpc":"2.0","id":1,"method":"Metadata"}
+//	<- {"jsonrpc":"2.0","id":1,"result":{"api_version":1,"name":"echo","version":"0.1.0","capabilities":[]}}
+//
+// Methods:
+//
+//	Metadata  result: PluginMetadata object
+//	Type      result: string, the worker type used in workers.yaml
+//	Info      result: string
+//	Args      params: array of strings; result: null
+//	Run       result: null, sent only when the work is finished
+//	Stop      result: null
+//
+// Run and Stop may be in flight at the same time, so a plugin must keep
+// reading stdin while Run is executing. Every method but Run must be answered
+// within EXEC_PLUGIN_CALL_TIMEOUT, otherwise the plugin is killed. Failures are reported as a JSON-RPC
+// error object {"code":-32000,"message":"..."}.
+//
+// Stdout is reserved for the protocol. Anything the plugin writes to stderr
+// is captured as worker output. A plugin may also send the notification
+// {"jsonrpc":"2.0","method":"log","params":{"line":"..."}}, which is written
+// to the worker stdout. When stdin is closed the plugin must exit, a plugin
+// that is still running after EXEC_PLUGIN_CLOSE_TIMEOUT is killed.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/control"
+	"github.com/uwine4850/anthill/pkg/infra/outputs"
+)
+
+const EXEC_PLUGIN_MAX_MESSAGE = 1024 * 1024
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int64  `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcMessage struct {
+	ID     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+type logParams struct {
+	Line string `json:"line"`
+}
+
+type outputParams struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ExecPlugin is a WorkerAnt backed by an executable plugin.
+type ExecPlugin struct {
+	path       string
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	writeMu    sync.Mutex
+	nextID     atomic.Int64
+	pendingMu  sync.Mutex
+	pending    map[int64]chan rpcMessage
+	exited     chan struct{}
+	exitErr    error
+	logOut     io.Writer
+	workerType string
+	info       string
+
+	callTimeout  time.Duration
+	closeTimeout time.Duration
+}
+
+// IsExecPlugin reports whether the plugin path refers to an executable plugin rather than a Go .so plugin.
+func IsExecPlugin(pluginPath string) bool {
+	return filepath.Ext(pluginPath) != ".so"
+}
+
+// OpenExecPlugin starts the executable plugin and checks its metadata.
+func OpenExecPlugin(pluginPath string) (*ExecPlugin, *dmnworker.PluginMetadata, error) {
+	p, err := startExecPlugin(pluginPath, os.Stdout)
+	if err != nil {
+		return nil, nil, err
+	}
+	var metadata dmnworker.PluginMetadata
+	if err := p.call("Metadata", nil, &metadata); err != nil {
+		p.Close()
+		return nil, nil, err
+	}
+	if err := CheckMetadata(&metadata); err != nil {
+		p.Close()
+		return nil, nil, fmt.Errorf("plugin %s: %s", pluginPath, err)
+	}
+	if err := p.call("Type", nil, &p.workerType); err != nil {
+		p.Close()
+		return nil, nil, err
+	}
+	if err := p.call("Info", nil, &p.info); err != nil {
+		p.Close()
+		return nil, nil, err
+	}
+	return p, &metadata, nil
+}
+
+func startExecPlugin(pluginPath string, logOut io.Writer) (*ExecPlugin, error) {
+	cmd := exec.Command(pluginPath)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin pipe error: %s", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout pipe error: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %s", pluginPath, err)
+	}
+	p := &ExecPlugin{
+		path:    pluginPath,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[int64]chan rpcMessage),
+		exited:  make(chan struct{}),
+		logOut:  logOut,
+
+		callTimeout:  config.EXEC_PLUGIN_CALL_TIMEOUT,
+		closeTimeout: config.EXEC_PLUGIN_CLOSE_TIMEOUT,
+	}
+	go p.readMessages(stdout)
+	return p, nil
+}
+
+func (p *ExecPlugin) Run() error {
+	return p.call("Run", nil, nil)
+}
+
+func (p *ExecPlugin) Stop() error {
+	return p.call("Stop", nil, nil)
+}
+
+func (p *ExecPlugin) Type() string {
+	return p.workerType
+}
+
+func (p *ExecPlugin) Info() string {
+	return p.info
+}
+
+func (p *ExecPlugin) Args(args ...string) error {
+	if args == nil {
+		args = []string{}
+	}
+	return p.call("Args", args, nil)
+}
+
+// Close closes the plugin stdin and waits for the plugin to exit. A plugin
+// that does not exit in time is killed.
+func (p *ExecPlugin) Close() error {
+	p.writeMu.Lock()
+	err := p.stdin.Close()
+	p.writeMu.Unlock()
+	select {
+	case <-p.exited:
+	case <-time.After(p.closeTimeout):
+		if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+		<-p.exited
+	}
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (p *ExecPlugin) call(method string, params any, result any) error {
+	id := p.nextID.Add(1)
+	respCh := make(chan rpcMessage, 1)
+	p.pendingMu.Lock()
+	p.pending[id] = respCh
+	p.pendingMu.Unlock()
+	defer func() {
+		p.pendingMu.Lock()
+		delete(p.pending, id)
+		p.pendingMu.Unlock()
+	}()
+
+	data, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	p.writeMu.Lock()
+	_, err = p.stdin.Write(append(data, '\n'))
+	p.writeMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("plugin %s: %s: %s", p.path, method, err)
+	}
+
+	// Run lasts as long as the work of the plugin, so only the other calls have a deadline.
+	var timeout <-chan time.Time
+	if method != "Run" {
+		timer := time.NewTimer(p.callTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case resp := <-respCh:
+		if resp.Error != nil {
+			return fmt.Errorf("plugin %s: %s: %s", p.path, method, resp.Error.Message)
+		}
+		if result != nil && len(resp.Result) != 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("plugin %s: %s: invalid result: %s", p.path, method, err)
+			}
+		}
+		return nil
+	case <-p.exited:
+		return fmt.Errorf("plugin %s: %s: plugin exited: %v", p.path, method, p.exitErr)
+	case <-timeout:
+		if err := p.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("plugin %s: %s: no response within %s, kill: %s", p.path, method, p.callTimeout, err)
+		}
+		return fmt.Errorf("plugin %s: %s: no response within %s, plugin killed", p.path, method, p.callTimeout)
+	}
+}
+
+func (p *ExecPlugin) readMessages(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), EXEC_PLUGIN_MAX_MESSAGE)
+	for scanner.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "plugin %s: invalid message: %s\n", p.path, err)
+			continue
+		}
+		if msg.ID == nil {
+			p.handleNotification(msg)
+			continue
+		}
+		// A response is delivered once, a late or duplicate one is dropped.
+		p.pendingMu.Lock()
+		respCh, ok := p.pending[*msg.ID]
+		delete(p.pending, *msg.ID)
+		p.pendingMu.Unlock()
+		if !ok {
+			fmt.Fprintf(os.Stderr, "plugin %s: dropped response with unknown id %d\n", p.path, *msg.ID)
+			continue
+		}
+		select {
+		case respCh <- msg:
+		default:
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin %s: read error: %s\n", p.path, err)
+	}
+	p.exitErr = p.cmd.Wait()
+	close(p.exited)
+}
+
+func (p *ExecPlugin) handleNotification(msg rpcMessage) {
+	switch msg.Method {
+	case "log":
+		var params logParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			fmt.Fprintf(os.Stderr, "plugin %s: invalid log notification: %s\n", p.path, err)
+			return
+		}
+		fmt.Fprintln(p.logOut, params.Line)
+	case "ready":
+		if err := control.Ready(); err != nil {
+			fmt.Fprintf(os.Stderr, "plugin %s: ready: %s\n", p.path, err)
+		}
+	case "output":
+		var params outputParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			fmt.Fprintf(os.Stderr, "plugin %s: invalid output notification: %s\n", p.path, err)
+			return
+		}
+		if err := outputs.Set(params.Key, params.Value); err != nil {
+			fmt.Fprintf(os.Stderr, "plugin %s: output %s: %s\n", p.path, params.Key, err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "plugin %s: unknown notification %s\n", p.path, msg.Method)
+	}
+}
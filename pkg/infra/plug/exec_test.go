@@ -0,0 +1,154 @@
+package plug
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+)
+
+var fixturePath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "anthill-plug")
+	if err != nil {
+		panic(err)
+	}
+	fixturePath = filepath.Join(dir, "fixture")
+	if out, err := exec.Command("go", "build", "-o", fixturePath, "./testdata/fixture").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		panic(string(out))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// syncBuffer collects the log lines written by the reader goroutine of a plugin.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func startFixture(t *testing.T, mode string) (*ExecPlugin, *syncBuffer) {
+	t.Helper()
+	t.Setenv("FIXTURE_MODE", mode)
+	logOut := &syncBuffer{}
+	p, err := startExecPlugin(fixturePath, logOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.callTimeout = 500 * time.Millisecond
+	p.closeTimeout = 500 * time.Millisecond
+	return p, logOut
+}
+
+func TestOpenExecPlugin(t *testing.T) {
+	t.Setenv("FIXTURE_MODE", "")
+	p, metadata, err := OpenExecPlugin(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if metadata.Name != "fixture" || metadata.APIVersion != config.PLUGIN_API_VERSION {
+		t.Fatalf("unexpected metadata %+v", metadata)
+	}
+	if p.Type() != "fixture" || p.Info() != "fixture plugin" {
+		t.Fatalf("unexpected type %q and info %q", p.Type(), p.Info())
+	}
+}
+
+func TestExecPluginNotifications(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(config.ENV_OUTPUTS_DIR, dir)
+	p, logOut := startFixture(t, "")
+	defer p.Close()
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// Notifications are handled by the reader before the response that follows them.
+	if logOut.String() != "running\n" {
+		t.Fatalf("unexpected log %q", logOut.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "path"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "/data" {
+		t.Fatalf("unexpected output %q", data)
+	}
+}
+
+func TestExecPluginCrash(t *testing.T) {
+	p, _ := startFixture(t, "crash")
+	defer p.Close()
+	err := p.Run()
+	if err == nil || !strings.Contains(err.Error(), "plugin exited") {
+		t.Fatalf("expected an exit error, got %v", err)
+	}
+	if err := p.Stop(); err == nil {
+		t.Fatal("expected an error from a call to an exited plugin")
+	}
+}
+
+func TestExecPluginCallTimeout(t *testing.T) {
+	p, _ := startFixture(t, "silent")
+	defer p.Close()
+	err := p.Stop()
+	if err == nil || !strings.Contains(err.Error(), "plugin killed") {
+		t.Fatalf("expected a timeout error, got %v", err)
+	}
+	select {
+	case <-p.exited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("plugin was not killed")
+	}
+}
+
+func TestExecPluginCloseTimeout(t *testing.T) {
+	p, _ := startFixture(t, "ignore-eof")
+	closed := make(chan error, 1)
+	go func() {
+		closed <- p.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not kill the plugin")
+	}
+}
+
+func TestExecPluginDuplicateResponse(t *testing.T) {
+	p, _ := startFixture(t, "duplicate")
+	defer p.Close()
+	var workerType string
+	if err := p.call("Type", nil, &workerType); err != nil {
+		t.Fatal(err)
+	}
+	// The reader must not stall on the second response of Type.
+	var info string
+	if err := p.call("Info", nil, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info != "fixture plugin" {
+		t.Fatalf("unexpected info %q", info)
+	}
+}
@@ -1,36 +1,129 @@
 package plug
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
 	"plugin"
 
+	"github.com/uwine4850/anthill/internal/pathutils"
 	"github.com/uwine4850/anthill/pkg/config"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
 )
 
-func OpenPlugin(pluginPath string) (*plugin.Symbol, error) {
+func OpenPlugin(pluginPath string) (*plugin.Symbol, *dmnworker.PluginMetadata, error) {
 	p, err := plugin.Open(pluginPath)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	metadata, err := lookupMetadata(p, pluginPath)
+	if err != nil {
+		return nil, nil, err
 	}
 	sym, err := p.Lookup(config.EXPORT_PLUGIN_NAME)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	return &sym, metadata, nil
+}
+
+func lookupMetadata(p *plugin.Plugin, pluginPath string) (*dmnworker.PluginMetadata, error) {
+	sym, err := p.Lookup(config.EXPORT_METADATA_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s does not export %s: %s", pluginPath, config.EXPORT_METADATA_NAME, err)
+	}
+	metadata, ok := sym.(*dmnworker.PluginMetadata)
+	if !ok {
+		return nil, fmt.Errorf("plugin %s: %s has type %T, expected dmnworker.PluginMetadata", pluginPath, config.EXPORT_METADATA_NAME, sym)
+	}
+	if err := CheckMetadata(metadata); err != nil {
+		return nil, fmt.Errorf("plugin %s: %s", pluginPath, err)
 	}
-	return &sym, nil
+	return metadata, nil
+}
+
+func CheckMetadata(metadata *dmnworker.PluginMetadata) error {
+	if metadata.APIVersion != config.PLUGIN_API_VERSION {
+		return fmt.Errorf("incompatible plugin API version %d, orchestrator supports %d", metadata.APIVersion, config.PLUGIN_API_VERSION)
+	}
+	if metadata.Name == "" {
+		return fmt.Errorf("plugin metadata has no name")
+	}
+	return nil
 }
 
 var builtinList = []string{
-	"pkg/infra/plug/plugins/builtin_list/cmd.so",
+	"cmd.so",
 }
 
+// builtinDirs are searched relative to the orchestrator binary and then to the working directory.
+var builtinDirs = []string{
+	"plugins/builtin",
+	"pkg/infra/plug/plugins/builtin_list",
+}
+
+// BuiltinList returns the paths of the builtin plugins. A plugin that is not found
+// keeps its path relative to the working directory so that loading it reports the error.
 func BuiltinList() ([]string, error) {
+	baseDirs := []string{}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err := filepath.EvalSymlinks(exe); err == nil {
+			baseDirs = append(baseDirs, filepath.Dir(exe))
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	baseDirs = append(baseDirs, wd)
+
 	list := make([]string, len(builtinList))
 	for i := 0; i < len(builtinList); i++ {
-		absPath, err := filepath.Abs(builtinList[i])
-		if err != nil {
-			return nil, err
+		list[i] = filepath.Join(wd, builtinDirs[len(builtinDirs)-1], builtinList[i])
+	search:
+		for _, baseDir := range baseDirs {
+			for _, dir := range builtinDirs {
+				path := filepath.Join(baseDir, dir, builtinList[i])
+				if err := pathutils.Exists(path); err == nil {
+					list[i] = path
+					break search
+				}
+			}
 		}
-		list[i] = absPath
 	}
 	return list, nil
 }
+
+type PluginsResponse struct {
+	Plugins []dmnworker.PluginInfo
+	Error   string
+}
+
+func SendPluginsResponse(w io.Writer, plugins []dmnworker.PluginInfo) error {
+	return socket.SendRequest(w, &PluginsResponse{Plugins: plugins})
+}
+
+func ListPlugins() ([]dmnworker.PluginInfo, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := dmnsocket.Request{Action: "plugins"}
+	if err := socket.SendRequest(conn, &req); err != nil {
+		return nil, err
+	}
+	var resp PluginsResponse
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Plugins, nil
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
 )
 
 type Command struct{}
@@ -36,3 +39,10 @@ func (c *Command) Args(args ...string) error {
 }
 
 var Plugin Command
+
+var Metadata = dmnworker.PluginMetadata{
+	APIVersion:   config.PLUGIN_API_VERSION,
+	Name:         "cmd",
+	Version:      "1.0.0",
+	Capabilities: []string{"args"},
+}
@@ -0,0 +1,63 @@
+// Command fixture is an executable plugin for the tests of the plug package.
+// FIXTURE_MODE selects a misbehaviour: silent never answers, crash exits during
+// Run, ignore-eof keeps running after stdin is closed and duplicate answers Type twice.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+type request struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+}
+
+var writeMu sync.Mutex
+
+func send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	data, _ := json.Marshal(msg)
+	writeMu.Lock()
+	defer writeMu.Unlock()
+	os.Stdout.Write(append(data, '\n'))
+}
+
+func main() {
+	mode := os.Getenv("FIXTURE_MODE")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			os.Exit(2)
+		}
+		if mode == "silent" {
+			continue
+		}
+		var result any
+		switch req.Method {
+		case "Metadata":
+			result = map[string]any{"api_version": 1, "name": "fixture", "version": "0.1.0", "capabilities": []string{}}
+		case "Type":
+			result = "fixture"
+			if mode == "duplicate" {
+				send(map[string]any{"id": req.ID, "result": result})
+			}
+		case "Info":
+			result = "fixture plugin"
+		case "Run":
+			if mode == "crash" {
+				os.Exit(3)
+			}
+			send(map[string]any{"method": "log", "params": map[string]string{"line": "running"}})
+			send(map[string]any{"method": "output", "params": map[string]string{"key": "path", "value": "/data"}})
+		}
+		send(map[string]any{"id": req.ID, "result": result})
+	}
+	if mode == "ignore-eof" {
+		time.Sleep(time.Hour)
+	}
+}
@@ -1,130 +1,364 @@
 package process
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"maps"
+	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/uwine4850/anthill/pkg/config"
 	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
 	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/control"
+	"github.com/uwine4850/anthill/pkg/infra/outputs"
 )
 
+var ErrNotRunning = errors.New("worker is not running")
+
 type AntWorkerProcess struct {
-	ants           *map[string]dmnworker.PluginAnt
+	pluginAnt      dmnworker.PluginAnt
 	runningWorkers *sync.Map
 	name           string
 	streamer       dmnprocess.Streamer
-	onDoneFn       func()
+	onDoneFn       func(err error)
+	onReadyFn      func()
+	onReloadFn     func()
+	opMu           sync.Mutex
+	mu             sync.Mutex
+	done           chan struct{}
+	stopping       atomic.Bool
+	generation     int
+	pid            int
+	exitCode       int
+	exited         bool
+	ready          bool
 }
 
-func (p *AntWorkerProcess) New(ants *map[string]dmnworker.PluginAnt, name string) dmnworker.AWorkerProcess {
+func (p *AntWorkerProcess) New(pluginAnt dmnworker.PluginAnt, name string, streamer dmnprocess.Streamer) dmnworker.AWorkerProcess {
+	done := make(chan struct{})
+	close(done)
 	return &AntWorkerProcess{
-		ants:           ants,
+		pluginAnt:      pluginAnt,
 		runningWorkers: &sync.Map{},
 		name:           name,
-		streamer:       NewAntWorkerStreamer(name),
+		streamer:       streamer,
+		onDoneFn:       func(err error) {},
+		onReadyFn:      func() {},
+		onReloadFn:     func() {},
+		done:           done,
 	}
 }
 
 func (p *AntWorkerProcess) Run() error {
-	pluginAnt, ok := (*p.ants)[p.name]
-	if !ok {
-		return fmt.Errorf("cannot run worker <%s>; it does not exists", p.name)
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	return p.run()
+}
+
+func (p *AntWorkerProcess) Stop() error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	return p.stop()
+}
+
+// Restart stops the worker, waits for it to exit and starts it again.
+// A worker that is not running is simply started.
+func (p *AntWorkerProcess) Restart() error {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	if err := p.stop(); err != nil && !errors.Is(err, ErrNotRunning) {
+		return err
 	}
-	go func(ant dmnworker.PluginAnt) {
-		defer p.streamer.Close()
-		defer p.onDoneFn()
+	return p.run()
+}
 
-		cmd, stdout, stderr, err := p.initLauncher(&ant)
-		if err != nil {
-			log.Println(err)
-		}
-		if err := cmd.Start(); err != nil {
-			log.Println("Start error: ", err)
-			return
-		}
-		p.runningWorkers.Store(p.name, cmd)
+func (p *AntWorkerProcess) Done() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.done
+}
 
-		if err := p.initAndRunStreamer(stdout, stderr); err != nil {
-			log.Println(err)
-		}
+func (p *AntWorkerProcess) OnDone(fn func(err error)) {
+	p.onDoneFn = fn
+}
+
+// OnReload sets the function that is called after the worker was started again
+// because it exited with an error.
+func (p *AntWorkerProcess) OnReload(fn func()) {
+	p.onReloadFn = fn
+}
+
+// OnReady sets the function that is called when the running worker sends the ready notification.
+func (p *AntWorkerProcess) OnReady(fn func()) {
+	p.onReadyFn = fn
+}
+
+// SetPluginAnt replaces the ant of the worker. It takes effect on the next run.
+func (p *AntWorkerProcess) SetPluginAnt(pluginAnt dmnworker.PluginAnt) {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	p.pluginAnt = pluginAnt
+}
+
+func (p *AntWorkerProcess) Stats() dmnworker.ProcessStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return dmnworker.ProcessStats{
+		Pid:      p.pid,
+		Runs:     p.generation,
+		ExitCode: p.exitCode,
+		Exited:   p.exited,
+		Ready:    p.ready,
+	}
+}
+
+func (p *AntWorkerProcess) run() error {
+	pluginAnt := p.pluginAnt
+	if _, ok := p.runningWorkers.Load(p.name); ok {
+		return fmt.Errorf("worker <%s> already running", p.name)
+	}
+
+	cmd, stdout, stderr, err := p.initLauncher(&pluginAnt)
+	if err != nil {
+		return err
+	}
+	controlPipe, err := initControl(cmd)
+	if err != nil {
+		closeWriters(cmd)
+		stdout.Close()
+		stderr.Close()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		closeWriters(cmd)
+		stdout.Close()
+		stderr.Close()
+		controlPipe.Close()
+		return fmt.Errorf("start error: %s", err)
+	}
+	closeWriters(cmd)
+	p.stopping.Store(false)
+	p.runningWorkers.Store(p.name, cmd)
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.done = done
+	p.generation++
+	generation := p.generation
+	p.pid = cmd.Process.Pid
+	p.ready = false
+	p.mu.Unlock()
+
+	p.streamer.StartRun(generation)
+	readers := p.readOutput(stdout, stderr)
+	go p.readControl(controlPipe, generation)
 
-		if err := cmd.Wait(); err != nil {
+	go func() {
+		defer close(done)
+
+		err := cmd.Wait()
+		p.mu.Lock()
+		p.pid = 0
+		if cmd.ProcessState != nil {
+			p.exitCode = cmd.ProcessState.ExitCode()
+			p.exited = true
+		}
+		p.mu.Unlock()
+		drainOutput(readers, stdout, stderr)
+		p.streamer.EndRun(generation, err)
+		if err != nil {
 			log.Println(p.name, "wait error:", err)
+		}
+		switch {
+		case err == nil:
+			p.runningWorkers.Delete(p.name)
+		case p.stopping.Load():
+			err = nil
+		case pluginAnt.Reload:
+			// The worker is not done while it is restarted, only a failed restart is reported.
 			go func() {
-				if err := p.killAndReloadOnError(pluginAnt); err != nil {
+				restarted, err := p.killAndReloadOnError(pluginAnt)
+				if err != nil {
 					log.Printf("Relaod %s error: %s\n", p.name, err)
+					p.onDoneFn(err)
+					return
+				}
+				if restarted {
+					p.onReloadFn()
 				}
 			}()
 			return
+		default:
+			// The process has exited, it is removed before done is closed so it can run again at once.
+			p.runningWorkers.Delete(p.name)
 		}
-	}(pluginAnt)
+		p.onDoneFn(err)
+	}()
 	return nil
 }
 
-func (p *AntWorkerProcess) Stop() error {
+func (p *AntWorkerProcess) stop() error {
 	_cmd, ok := p.runningWorkers.Load(p.name)
 	if !ok {
-		return fmt.Errorf("running worker <%s> not exists", p.name)
+		return fmt.Errorf("running worker <%s>: %w", p.name, ErrNotRunning)
 	}
 	cmd := _cmd.(*exec.Cmd)
-	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+	done := p.Done()
+	p.stopping.Store(true)
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
 		return err
 	}
+	select {
+	case <-done:
+	case <-time.After(config.STOP_TIMEOUT):
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return err
+		}
+		<-done
+	}
 	p.runningWorkers.Delete(p.name)
 	return nil
 }
 
-func (p *AntWorkerProcess) OnDone(fn func()) {
-	p.onDoneFn = fn
-}
-
-func (p *AntWorkerProcess) initLauncher(pluginAnt *dmnworker.PluginAnt) (cmd *exec.Cmd, stdout io.Reader, stderr io.Reader, err error) {
+// initLauncher connects the launcher output to pipes owned by the process rather
+// than by cmd, so that cmd.Wait does not close them before the output is read.
+func (p *AntWorkerProcess) initLauncher(pluginAnt *dmnworker.PluginAnt) (cmd *exec.Cmd, stdout *os.File, stderr *os.File, err error) {
 	cmd = exec.Command("./launcher", append([]string{pluginAnt.Path}, pluginAnt.Args...)...)
-	cmdStdout, err := cmd.StdoutPipe()
+	cmd.Env = append(os.Environ(), config.ENV_WORKER_NAME+"="+p.name)
+	if pluginAnt.Parent != "" {
+		cmd.Env = append(cmd.Env, config.ENV_REPLICA_INDEX+"="+strconv.Itoa(pluginAnt.Replica))
+	}
+	outputsDir, err := outputs.Dir(p.name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cmd.Env = append(cmd.Env, config.ENV_OUTPUTS_DIR+"="+outputsDir)
+	for _, key := range slices.Sorted(maps.Keys(pluginAnt.Env)) {
+		cmd.Env = append(cmd.Env, key+"="+pluginAnt.Env[key])
+	}
+	stdout, stdoutWriter, err := os.Pipe()
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("stdout pipe error: %s", err)
 	}
-	cmdStderr, err := cmd.StderrPipe()
+	stderr, stderrWriter, err := os.Pipe()
 	if err != nil {
+		stdout.Close()
+		stdoutWriter.Close()
 		return nil, nil, nil, fmt.Errorf("stderr pipe error: %s", err)
 	}
-	return cmd, cmdStdout, cmdStderr, nil
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = stderrWriter
+	return cmd, stdout, stderr, nil
 }
 
-func (p *AntWorkerProcess) initAndRunStreamer(stdout io.Reader, stderr io.Reader) error {
-	go p.streamer.ReadText(stdout)
-	go p.streamer.ReadText(stderr)
-
-	if err := p.streamer.Stream(); err != nil {
-		return fmt.Errorf("stream error: %s", err)
+// initControl passes the writer of a control pipe to the launcher as its first extra
+// file. The returned reader gets EOF once the launcher has exited.
+func initControl(cmd *exec.Cmd) (*os.File, error) {
+	controlPipe, controlWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("control pipe error: %s", err)
 	}
-	return nil
+	cmd.ExtraFiles = []*os.File{controlWriter}
+	cmd.Env = append(cmd.Env, config.ENV_CONTROL_FD+"=3")
+	return controlPipe, nil
 }
 
-func (p *AntWorkerProcess) killAndReloadOnError(pluginAnt dmnworker.PluginAnt) error {
-	if pluginAnt.Reload {
-		if err := p.kill(); err != nil {
-			return err
-		}
-		if err := p.Run(); err != nil {
-			return err
+// readControl handles the notifications of one run of the worker.
+func (p *AntWorkerProcess) readControl(controlPipe *os.File, generation int) {
+	defer controlPipe.Close()
+	scanner := bufio.NewScanner(controlPipe)
+	for scanner.Scan() {
+		switch scanner.Text() {
+		case control.NOTIFY_READY:
+			p.mu.Lock()
+			current := p.generation == generation
+			if current {
+				p.ready = true
+			}
+			p.mu.Unlock()
+			if current {
+				p.onReadyFn()
+			}
+		default:
+			log.Printf("%s: unknown notification %q\n", p.name, scanner.Text())
 		}
 	}
-	return nil
+}
+
+// closeWriters closes the parent copies of the pipe writers, so the readers
+// get EOF once the launcher and its children have exited.
+func closeWriters(cmd *exec.Cmd) {
+	cmd.Stdout.(*os.File).Close()
+	cmd.Stderr.(*os.File).Close()
+	for i := 0; i < len(cmd.ExtraFiles); i++ {
+		cmd.ExtraFiles[i].Close()
+	}
+}
+
+func (p *AntWorkerProcess) readOutput(stdout *os.File, stderr *os.File) *sync.WaitGroup {
+	readers := &sync.WaitGroup{}
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		p.streamer.ReadText(stdout, dmnprocess.STREAM_STDOUT)
+	}()
+	go func() {
+		defer readers.Done()
+		p.streamer.ReadText(stderr, dmnprocess.STREAM_STDERR)
+	}()
+	return readers
+}
+
+// drainOutput waits until the output of the exited launcher is read. If a child
+// of the launcher still holds the pipes, they are closed after a timeout.
+func drainOutput(readers *sync.WaitGroup, stdout *os.File, stderr *os.File) {
+	drained := make(chan struct{})
+	go func() {
+		readers.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(config.OUTPUT_DRAIN_TIMEOUT):
+	}
+	stdout.Close()
+	stderr.Close()
+	<-drained
+}
+
+// killAndReloadOnError starts the worker again after it exited with an error. It
+// reports whether the worker was restarted.
+func (p *AntWorkerProcess) killAndReloadOnError(pluginAnt dmnworker.PluginAnt) (bool, error) {
+	p.opMu.Lock()
+	defer p.opMu.Unlock()
+	if err := p.kill(); err != nil {
+		return false, err
+	}
+	if !pluginAnt.Reload || p.stopping.Load() {
+		return false, nil
+	}
+	if err := p.run(); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func (p *AntWorkerProcess) kill() error {
 	_cmd, ok := p.runningWorkers.Load(p.name)
 	if !ok {
-		return fmt.Errorf("running worker <%s> not exists", p.name)
+		return fmt.Errorf("running worker <%s>: %w", p.name, ErrNotRunning)
 	}
 	cmd := _cmd.(*exec.Cmd)
 	if cmd.ProcessState == nil || !cmd.ProcessState.Exited() {
-		if err := cmd.Process.Kill(); err != nil {
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
 			return err
 		}
 	}
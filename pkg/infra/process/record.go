@@ -0,0 +1,109 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+)
+
+var levelKeys = []string{"level", "lvl", "severity"}
+
+// ReadOptions filters the records printed by ReadStream and ReadHistory.
+type ReadOptions struct {
+	JSON       bool
+	NoColor    bool
+	Since      time.Time
+	Until      time.Time
+	StderrOnly bool
+	Grep       *regexp.Regexp
+}
+
+func (o ReadOptions) match(record dmnprocess.LogRecord) bool {
+	if !o.Since.IsZero() && record.Time.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && record.Time.After(o.Until) {
+		return false
+	}
+	if o.StderrOnly && record.Stream != dmnprocess.STREAM_STDERR {
+		return false
+	}
+	if o.Grep != nil && !o.Grep.MatchString(record.Line) {
+		return false
+	}
+	return true
+}
+
+// past reports whether no later record can match because the until time has passed.
+func (o ReadOptions) past(record dmnprocess.LogRecord) bool {
+	return !o.Until.IsZero() && record.Time.After(o.Until)
+}
+
+func (o ReadOptions) write(w io.Writer, record dmnprocess.LogRecord) error {
+	if o.JSON {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+	_, err := fmt.Fprintln(w, record.Line)
+	return err
+}
+
+// ParseTime accepts an RFC 3339 time or a duration that is subtracted from now, such as 10m.
+func ParseTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time <%s>, expected RFC 3339 or a duration", value)
+	}
+	return t, nil
+}
+
+// decodeRecord decodes a stored record. Lines written before records were
+// introduced are returned as plain stdout records without a time.
+func decodeRecord(line string) dmnprocess.LogRecord {
+	var record dmnprocess.LogRecord
+	if err := json.Unmarshal([]byte(line), &record); err != nil || record.Stream == "" {
+		return dmnprocess.LogRecord{Stream: dmnprocess.STREAM_STDOUT, Line: line}
+	}
+	return record
+}
+
+// parseLevel extracts the level of a JSON or logfmt line.
+func parseLevel(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			return ""
+		}
+		for _, key := range levelKeys {
+			if level, ok := fields[key].(string); ok {
+				return strings.ToLower(level)
+			}
+		}
+		return ""
+	}
+	for _, field := range strings.Fields(line) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		for _, levelKey := range levelKeys {
+			if key == levelKey {
+				return strings.ToLower(strings.Trim(value, `"`))
+			}
+		}
+	}
+	return ""
+}
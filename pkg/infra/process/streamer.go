@@ -2,62 +2,328 @@ package process
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net"
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/uwine4850/anthill/internal/pathutils"
+	"github.com/uwine4850/anthill/pkg/config"
 	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+	"github.com/uwine4850/anthill/pkg/infra/logfile"
+	"github.com/uwine4850/anthill/pkg/infra/logsink"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
 )
 
+// MAX_HISTORY_LEN is the default number of records kept in memory for new stream clients.
 const MAX_HISTORY_LEN = 300
 
+// Subscriber receives the records of a worker from the moment it subscribed.
+// If it falls more than its buffer behind, it is dropped and Records is closed
+// with Lagging set, so a slow client never blocks the worker output.
+type Subscriber struct {
+	Records chan dmnprocess.LogRecord
+	lagging atomic.Bool
+}
+
+func (sub *Subscriber) Lagging() bool {
+	return sub.lagging.Load()
+}
+
 type AntWorkerStreamer struct {
-	Name     string
-	logs     chan string
-	history  []string
-	socket   string
-	mu       sync.Mutex
-	listener net.Listener
-	isClose  atomic.Bool
-	wg       sync.WaitGroup
+	Name         string
+	pluginAnt    dmnworker.PluginAnt
+	generation   atomic.Int64
+	history      []dmnprocess.LogRecord
+	historyLines int
+	maxLineBytes int
+	overflow     string
+	subscribers  map[*Subscriber]struct{}
+	lineCounts   map[string]int64
+	socket       string
+	mu           sync.Mutex
+	listener     net.Listener
+	isClose      atomic.Bool
+	logFile      *logfile.RotatingFile
+	sinks        []dmnprocess.LogSink
+}
+
+// NewAntWorkerStreamer creates the log stream of the worker. It lives as long as the
+// worker is configured, so followers stay connected across restarts.
+// If the log config has a directory, every record is also written to the worker log file.
+func NewAntWorkerStreamer(antWorkerName string, pluginAnt dmnworker.PluginAnt) *AntWorkerStreamer {
+	logConfig := pluginAnt.Log
+	s := &AntWorkerStreamer{
+		Name:         antWorkerName,
+		pluginAnt:    pluginAnt,
+		historyLines: logConfig.HistoryLines,
+		maxLineBytes: logConfig.MaxLineBytes,
+		overflow:     logConfig.Overflow,
+		subscribers:  make(map[*Subscriber]struct{}),
+		lineCounts:   make(map[string]int64),
+		socket:       StreamSocket(antWorkerName),
+	}
+	if s.historyLines <= 0 {
+		s.historyLines = MAX_HISTORY_LEN
+	}
+	if s.maxLineBytes <= 0 {
+		s.maxLineBytes = config.LOG_MAX_LINE_BYTES
+	}
+	if s.overflow == "" {
+		s.overflow = dmnprocess.OVERFLOW_TRUNCATE
+	}
+	s.history = make([]dmnprocess.LogRecord, 0, s.historyLines)
+	if logConfig.Dir != "" {
+		logFile, err := logfile.Open(antWorkerName, logConfig)
+		if err != nil {
+			log.Printf("open log file of %s: %s\n", antWorkerName, err)
+		} else {
+			s.logFile = logFile
+		}
+	}
+	for _, sinkConfig := range pluginAnt.Sinks {
+		sink, err := logsink.Open(sinkConfig)
+		if err != nil {
+			log.Printf("open %s sink of %s: %s\n", sinkConfig.Type, antWorkerName, err)
+			continue
+		}
+		s.sinks = append(s.sinks, sink)
+	}
+	return s
+}
+
+// StartRun marks the start of a new run of the worker in the stream.
+func (s *AntWorkerStreamer) StartRun(generation int) {
+	s.generation.Store(int64(generation))
+	s.publish(s.newRecord(dmnprocess.STREAM_SYSTEM, fmt.Sprintf("--- run %d started ---", generation)))
 }
 
-func NewAntWorkerStreamer(antWorkerName string) dmnprocess.Streamer {
-	return &AntWorkerStreamer{
-		Name:    antWorkerName,
-		history: make([]string, 0, MAX_HISTORY_LEN),
-		logs:    make(chan string, 1),
-		socket:  makeStreamSocket(antWorkerName),
+// EndRun marks the exit of the run of the worker in the stream.
+func (s *AntWorkerStreamer) EndRun(generation int, err error) {
+	line := fmt.Sprintf("--- run %d exited ---", generation)
+	if err != nil {
+		line = fmt.Sprintf("--- run %d exited: %s ---", generation, err)
 	}
+	s.publish(s.newRecord(dmnprocess.STREAM_SYSTEM, line))
 }
 
 func (s *AntWorkerStreamer) Close() error {
 	s.isClose.Store(true)
-	s.wg.Wait()
-	close(s.logs)
+	s.mu.Lock()
+	for sub := range s.subscribers {
+		close(sub.Records)
+		delete(s.subscribers, sub)
+	}
+	s.mu.Unlock()
+	if s.logFile != nil {
+		if err := s.logFile.Close(); err != nil {
+			log.Printf("close log file of %s: %s\n", s.Name, err)
+		}
+	}
+	for i := 0; i < len(s.sinks); i++ {
+		logsink.Release(s.sinks[i])
+	}
+	if s.listener == nil {
+		return nil
+	}
 	return s.listener.Close()
 }
 
-func (s *AntWorkerStreamer) ReadText(reader io.Reader) {
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() && !s.isClose.Load() {
-		s.wg.Add(1)
-		text := scanner.Text()
-		s.mu.Lock()
-		if len(s.history) > MAX_HISTORY_LEN {
-			copy(s.history, s.history[1:])
-			s.history[len(s.history)-1] = text
-		} else {
-			s.history = append(s.history, text)
+// ReadText publishes every line of the reader. A line longer than the limit is
+// truncated or split into several records, so capture never stops on long lines.
+// A read error is logged and published as a system record.
+func (s *AntWorkerStreamer) ReadText(reader io.Reader, stream string) {
+	s.readText(reader, stream, s.newRecord)
+}
+
+func (s *AntWorkerStreamer) readText(reader io.Reader, stream string, newRecord func(stream string, line string) dmnprocess.LogRecord) {
+	r := bufio.NewReader(reader)
+	line := []byte{}
+	discard := false
+	split := false
+	for !s.isClose.Load() {
+		fragment, isPrefix, err := r.ReadLine()
+		if err != nil {
+			if len(line) != 0 && !discard {
+				s.publish(newRecord(stream, string(line)))
+			}
+			if err != io.EOF && !errors.Is(err, os.ErrClosed) {
+				log.Printf("read %s of %s: %s\n", stream, s.Name, err)
+				s.publish(newRecord(dmnprocess.STREAM_SYSTEM, fmt.Sprintf("%s capture stopped: %s", stream, err)))
+			}
+			return
+		}
+		if !discard {
+			line = append(line, fragment...)
 		}
-		s.mu.Unlock()
-		s.logs <- text
-		s.wg.Done()
+		for len(line) > s.maxLineBytes && !discard {
+			record := newRecord(stream, string(line[:s.maxLineBytes]))
+			record.Truncated = true
+			s.publish(record)
+			if s.overflow == dmnprocess.OVERFLOW_SPLIT {
+				line = append(line[:0], line[s.maxLineBytes:]...)
+				split = true
+			} else {
+				line = line[:0]
+				discard = true
+			}
+		}
+		if isPrefix {
+			continue
+		}
+		if !discard && (len(line) != 0 || !split) {
+			s.publish(newRecord(stream, string(line)))
+		}
+		line = line[:0]
+		discard = false
+		split = false
+	}
+}
+
+func (s *AntWorkerStreamer) newRecord(stream string, line string) dmnprocess.LogRecord {
+	record := dmnprocess.LogRecord{
+		Time:       time.Now(),
+		Stream:     stream,
+		Worker:     s.Name,
+		Parent:     s.pluginAnt.Parent,
+		Generation: int(s.generation.Load()),
+		Line:       line,
+	}
+	if s.pluginAnt.Parent != "" {
+		record.Replica = s.pluginAnt.Replica
+	}
+	if stream != dmnprocess.STREAM_SYSTEM {
+		record.Level = parseLevel(line)
+	}
+	return record
+}
+
+// ForSlot returns the stream of a parallel slot of a job. Slot 0 is the stream itself.
+func (s *AntWorkerStreamer) ForSlot(slot int) dmnprocess.Streamer {
+	if slot == 0 {
+		return s
+	}
+	return &slotStreamer{AntWorkerStreamer: s, slot: slot}
+}
+
+// slotStreamer publishes the runs of a slot to the stream of the job. Its records
+// carry the slot and its runs are counted apart from the other slots.
+type slotStreamer struct {
+	*AntWorkerStreamer
+	slot       int
+	generation atomic.Int64
+}
+
+// Stream does nothing, the socket is served by the stream of the job.
+func (s *slotStreamer) Stream() error {
+	return nil
+}
+
+// Close does nothing, the stream is closed with the job.
+func (s *slotStreamer) Close() error {
+	return nil
+}
+
+func (s *slotStreamer) ReadText(reader io.Reader, stream string) {
+	s.readText(reader, stream, s.newRecord)
+}
+
+func (s *slotStreamer) StartRun(generation int) {
+	s.generation.Store(int64(generation))
+	s.publish(s.newRecord(dmnprocess.STREAM_SYSTEM, fmt.Sprintf("--- slot %d run %d started ---", s.slot, generation)))
+}
+
+func (s *slotStreamer) EndRun(generation int, err error) {
+	line := fmt.Sprintf("--- slot %d run %d exited ---", s.slot, generation)
+	if err != nil {
+		line = fmt.Sprintf("--- slot %d run %d exited: %s ---", s.slot, generation, err)
+	}
+	s.publish(s.newRecord(dmnprocess.STREAM_SYSTEM, line))
+}
+
+func (s *slotStreamer) newRecord(stream string, line string) dmnprocess.LogRecord {
+	record := s.AntWorkerStreamer.newRecord(stream, line)
+	record.Generation = int(s.generation.Load())
+	record.Slot = s.slot
+	return record
+}
+
+// publish stores the record and sends it to every subscriber without blocking.
+func (s *AntWorkerStreamer) publish(record dmnprocess.LogRecord) {
+	if s.logFile != nil {
+		data, err := json.Marshal(record)
+		if err == nil {
+			err = s.logFile.WriteLine(string(data))
+		}
+		if err != nil {
+			log.Printf("write log file of %s: %s\n", s.Name, err)
+		}
+	}
+	// The sinks of a closed stream are released and may already be closed.
+	for i := 0; i < len(s.sinks) && !s.isClose.Load(); i++ {
+		if err := s.sinks[i].Write(record); err != nil {
+			log.Printf("write sink of %s: %s\n", s.Name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lineCounts[record.Stream]++
+	if len(s.history) >= s.historyLines {
+		copy(s.history, s.history[1:])
+		s.history[len(s.history)-1] = record
+	} else {
+		s.history = append(s.history, record)
+	}
+	for sub := range s.subscribers {
+		select {
+		case sub.Records <- record:
+		default:
+			sub.lagging.Store(true)
+			close(sub.Records)
+			delete(s.subscribers, sub)
+		}
+	}
+}
+
+// LineCounts returns the number of records published per stream.
+func (s *AntWorkerStreamer) LineCounts() map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.lineCounts)
+}
+
+// Subscribe returns a snapshot of the history and a subscriber that receives every later record.
+func (s *AntWorkerStreamer) Subscribe() ([]dmnprocess.LogRecord, *Subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	history := make([]dmnprocess.LogRecord, len(s.history))
+	copy(history, s.history)
+	sub := &Subscriber{Records: make(chan dmnprocess.LogRecord, config.STREAM_SUBSCRIBER_BUFFER)}
+	if s.isClose.Load() {
+		close(sub.Records)
+		return history, sub
+	}
+	s.subscribers[sub] = struct{}{}
+	return history, sub
+}
+
+func (s *AntWorkerStreamer) Unsubscribe(sub *Subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscribers[sub]; ok {
+		close(sub.Records)
+		delete(s.subscribers, sub)
 	}
 }
 
@@ -68,7 +334,12 @@ func (s *AntWorkerStreamer) Stream() error {
 		}
 	}
 
-	listener, err := net.Listen("unix", s.socket)
+	// The stream socket has no access control of its own, so only the owner of the
+	// orchestrator connects to it. Other users follow the logs through the control
+	// socket, where their role is checked.
+	listener, err := socket.ListenUnix(s.socket, func(path string) error {
+		return os.Chmod(path, 0600)
+	})
 	if err != nil {
 		return err
 	}
@@ -79,13 +350,11 @@ func (s *AntWorkerStreamer) Stream() error {
 		for !s.isClose.Load() {
 			conn, err := listener.Accept()
 			if err != nil {
-				log.Println("socket accept error:", err)
+				if !s.isClose.Load() {
+					log.Println("socket accept error:", err)
+				}
 				continue
 			}
-
-			// Clearing recorded channels before connecting to avoid duplication with history
-			s.drain()
-
 			go func(_conn net.Conn) {
 				defer _conn.Close()
 				s.printLogs(_conn)
@@ -95,48 +364,122 @@ func (s *AntWorkerStreamer) Stream() error {
 	return nil
 }
 
-func (s *AntWorkerStreamer) drain() {
-	for {
-		select {
-		case <-s.logs:
-		default:
+// printLogs sends the records to the client as JSON lines.
+func (s *AntWorkerStreamer) printLogs(conn net.Conn) {
+	history, sub := s.Subscribe()
+	defer s.Unsubscribe(sub)
+
+	enc := json.NewEncoder(conn)
+	for i := 0; i < len(history); i++ {
+		if err := enc.Encode(history[i]); err != nil {
 			return
 		}
 	}
-}
-
-func (s *AntWorkerStreamer) printLogs(conn net.Conn) {
-	s.mu.Lock()
-	for i := 0; i < len(s.history); i++ {
-		if _, err := fmt.Fprintln(conn, s.history[i]); err != nil {
+	for record := range sub.Records {
+		if err := enc.Encode(record); err != nil {
 			return
 		}
 	}
-	s.mu.Unlock()
+	if sub.Lagging() {
+		enc.Encode(s.newRecord(dmnprocess.STREAM_SYSTEM, "stream dropped, the client was too slow to read the logs"))
+	}
+}
 
-	for lineCh := range s.logs {
-		if _, err := fmt.Fprintln(conn, lineCh); err != nil {
-			return
+// ReadStream follows the log stream of the worker until the stream is closed.
+func ReadStream(antWorkerName string, opts ReadOptions) error {
+	return FollowStream(context.Background(), antWorkerName, opts, func(record dmnprocess.LogRecord) error {
+		if err := opts.write(os.Stdout, record); err != nil {
+			return fmt.Errorf("write error: %v", err)
 		}
-	}
+		return nil
+	})
 }
 
-func ReadStream(antWorkerName string) {
-	conn, err := net.Dial("unix", makeStreamSocket(antWorkerName))
+// FollowStream passes the records of the worker stream that match the options to fn
+// until the stream is closed, the context is done or fn returns an error.
+func FollowStream(ctx context.Context, antWorkerName string, opts ReadOptions, fn func(record dmnprocess.LogRecord) error) error {
+	conn, dec, err := openStream(antWorkerName, StreamSocket(antWorkerName))
 	if err != nil {
-		log.Fatalf("failed connect to socket: %v", err)
+		return err
 	}
 	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
 
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+	for {
+		var record dmnprocess.LogRecord
+		if err := dec.Decode(&record); err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				return fmt.Errorf("read error: %v", err)
+			}
+			return nil
+		}
+		if opts.past(record) {
+			return nil
+		}
+		if !opts.match(record) {
+			continue
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
 	}
-	if err := scanner.Err(); err != nil {
-		log.Fatalf("read error: %v", err)
+}
+
+// openStream connects to the stream of the worker. The stream of a remote
+// orchestrator, or of a local one owned by another user, is relayed by the
+// orchestrator on the control connection.
+func openStream(antWorkerName string, streamSocket string) (net.Conn, *json.Decoder, error) {
+	if !socket.IsRemote() {
+		conn, err := net.Dial("unix", streamSocket)
+		if errors.Is(err, os.ErrPermission) {
+			return relayStream(antWorkerName)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed connect to socket: %v", err)
+		}
+		return conn, json.NewDecoder(conn), nil
 	}
+	return relayStream(antWorkerName)
+}
+
+// relayStream asks the orchestrator to follow the stream of the worker on the control connection.
+func relayStream(antWorkerName string) (net.Conn, *json.Decoder, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := socket.SendRequest(conn, dmnsocket.Request{Action: "logs", Name: antWorkerName, Follow: true}); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	dec := json.NewDecoder(conn)
+	var resp dmnsocket.Response
+	if err := dec.Decode(&resp); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.Error != "" {
+		conn.Close()
+		return nil, nil, errors.New(resp.Error)
+	}
+	return conn, dec, nil
+}
+
+// ReadHistory prints the logs of the worker stored in the log directory,
+// including rotated files. It works for workers that are no longer running.
+func ReadHistory(logDir string, antWorkerName string, opts ReadOptions) error {
+	return logfile.ReadHistory(logDir, antWorkerName, func(line string) error {
+		record := decodeRecord(line)
+		if !opts.match(record) {
+			return nil
+		}
+		return opts.write(os.Stdout, record)
+	})
 }
 
-func makeStreamSocket(antWorkerName string) string {
+func StreamSocket(antWorkerName string) string {
 	return fmt.Sprintf("/tmp/anthill-%s.sock", antWorkerName)
 }
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// TestHelperDialStream is run as another user by TestStreamSocketOwnerOnly.
+func TestHelperDialStream(t *testing.T) {
+	path := os.Getenv("STREAM_TEST_SOCKET")
+	if path == "" {
+		return
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	conn.Close()
+	fmt.Println("connected")
+	os.Exit(0)
+}
+
+func TestStreamSocketOwnerOnly(t *testing.T) {
+	s := NewAntWorkerStreamer("stream-test", dmnworker.PluginAnt{})
+	s.socket = fmt.Sprintf("/tmp/anthill-stream-test-%d.sock", os.Getpid())
+	if err := s.Stream(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	info, err := os.Stat(s.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Fatalf("mode of the stream socket = %o, want 600", mode)
+	}
+	// The owner still reads the stream.
+	conn, err := net.Dial("unix", s.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if os.Getuid() != 0 {
+		t.Skip("connecting as another user requires root")
+	}
+	// The test binary is copied where the other user can run it.
+	binary := fmt.Sprintf("/tmp/anthill-stream-test-%d.bin", os.Getpid())
+	if err := copyExecutable(os.Args[0], binary); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(binary)
+	cmd := exec.Command(binary, "-test.run=^TestHelperDialStream$")
+	cmd.Env = append(os.Environ(), "STREAM_TEST_SOCKET="+s.socket)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("another user connected to the stream: %s", out)
+	}
+	if !strings.Contains(string(out), "permission denied") {
+		t.Fatalf("connect as another user: %s: %s", err, out)
+	}
+}
+
+func copyExecutable(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
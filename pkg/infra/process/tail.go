@@ -0,0 +1,144 @@
+package process
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnprocess "github.com/uwine4850/anthill/pkg/domain/dmn_process"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+)
+
+var prefixColors = []string{"\033[36m", "\033[33m", "\033[32m", "\033[35m", "\033[34m", "\033[31m"}
+
+const colorReset = "\033[0m"
+
+type recordHeap []dmnprocess.LogRecord
+
+func (h recordHeap) Len() int           { return len(h) }
+func (h recordHeap) Less(i, j int) bool { return h[i].Time.Before(h[j].Time) }
+func (h recordHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *recordHeap) Push(x any)        { *h = append(*h, x.(dmnprocess.LogRecord)) }
+func (h *recordHeap) Pop() any {
+	old := *h
+	record := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return record
+}
+
+// ReadStreams follows the streams of several workers and prints their records
+// ordered by time, each prefixed with the worker name. The targets are resolved
+// again periodically, so workers that start later are followed as well.
+func ReadStreams(resolve func() ([]dmnsocket.WorkerResult, error), opts ReadOptions) error {
+	t := &tail{
+		opts:      opts,
+		connected: map[string]struct{}{},
+		colors:    map[string]string{},
+		records:   make(chan dmnprocess.LogRecord, config.STREAM_SUBSCRIBER_BUFFER),
+	}
+	if err := t.connect(resolve); err != nil {
+		return err
+	}
+
+	refresh := time.NewTicker(config.TAIL_REFRESH_INTERVAL)
+	defer refresh.Stop()
+	flush := time.NewTicker(config.TAIL_MERGE_WINDOW / 2)
+	defer flush.Stop()
+	pending := &recordHeap{}
+	for {
+		select {
+		case record := <-t.records:
+			heap.Push(pending, record)
+		case <-flush.C:
+			until := time.Now().Add(-config.TAIL_MERGE_WINDOW)
+			for pending.Len() > 0 && (*pending)[0].Time.Before(until) {
+				if err := t.write(heap.Pop(pending).(dmnprocess.LogRecord)); err != nil {
+					return err
+				}
+			}
+		case <-refresh.C:
+			if err := t.connect(resolve); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+type tail struct {
+	opts      ReadOptions
+	mu        sync.Mutex
+	connected map[string]struct{}
+	colors    map[string]string
+	records   chan dmnprocess.LogRecord
+}
+
+func (t *tail) connect(resolve func() ([]dmnsocket.WorkerResult, error)) error {
+	results, err := resolve()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, result := range results {
+		if result.Socket == "" {
+			continue
+		}
+		if _, ok := t.connected[result.Name]; ok {
+			continue
+		}
+		conn, dec, err := openStream(result.Name, result.Socket)
+		if err != nil {
+			continue
+		}
+		t.connected[result.Name] = struct{}{}
+		if _, ok := t.colors[result.Name]; !ok {
+			t.colors[result.Name] = prefixColors[len(t.colors)%len(prefixColors)]
+		}
+		go t.follow(result.Name, conn, dec)
+	}
+	return nil
+}
+
+// follow reads the records of one worker until its stream ends.
+func (t *tail) follow(name string, conn net.Conn, dec *json.Decoder) {
+	defer func() {
+		conn.Close()
+		t.mu.Lock()
+		delete(t.connected, name)
+		t.mu.Unlock()
+	}()
+	for {
+		var record dmnprocess.LogRecord
+		if err := dec.Decode(&record); err != nil {
+			if err != io.EOF {
+				log.Printf("read %s: %s\n", name, err)
+			}
+			return
+		}
+		if t.opts.match(record) {
+			t.records <- record
+		}
+	}
+}
+
+func (t *tail) write(record dmnprocess.LogRecord) error {
+	if t.opts.JSON {
+		return t.opts.write(os.Stdout, record)
+	}
+	t.mu.Lock()
+	color := t.colors[record.Worker]
+	t.mu.Unlock()
+	if t.opts.NoColor {
+		_, err := fmt.Printf("%s | %s\n", record.Worker, record.Line)
+		return err
+	}
+	_, err := fmt.Printf("%s%s%s | %s\n", color, record.Worker, colorReset, record.Line)
+	return err
+}
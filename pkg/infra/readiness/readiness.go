@@ -0,0 +1,45 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// Probe runs the readiness probe once. It passes if the tcp address accepts a
+// connection, the http url answers with a 2xx or 3xx code or the command exits with
+// code zero within the timeout of the probe.
+func Probe(ctx context.Context, readinessConfig dmnworker.ReadinessConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessConfig.Timeout)
+	defer cancel()
+	switch {
+	case readinessConfig.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", readinessConfig.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case readinessConfig.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, readinessConfig.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("http status %d", resp.StatusCode)
+		}
+		return nil
+	case len(readinessConfig.Exec) > 0:
+		return exec.CommandContext(ctx, readinessConfig.Exec[0], readinessConfig.Exec[1:]...).Run()
+	}
+	return fmt.Errorf("no readiness probe")
+}
@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uwine4850/anthill/pkg/config"
+	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	"github.com/uwine4850/anthill/pkg/infra/jobs"
+	"github.com/uwine4850/anthill/pkg/infra/socket"
+	"github.com/uwine4850/anthill/pkg/infra/status"
+)
+
+const (
+	ON_FAILURE_STOP     = "stop"
+	ON_FAILURE_ROLLBACK = "rollback"
+)
+
+// Plan returns the stages in which the orchestrator can start all workers.
+func (r *Runner) Plan() ([][]string, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := socket.SendRequest(conn, dmnsocket.Request{Action: "plan", All: true}); err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+	resp, err := readResponse(conn)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Stages, nil
+}
+
+// RunPlan starts the workers stage by stage and waits until every worker of a stage
+// is started before the next stage. If a worker fails to start, the later stages are
+// not started. With ON_FAILURE_ROLLBACK the workers started by the plan are stopped
+// again, the last stage first.
+func (r *Runner) RunPlan(stages [][]string, onFailure string) error {
+	if onFailure != ON_FAILURE_STOP && onFailure != ON_FAILURE_ROLLBACK {
+		return fmt.Errorf("invalid failure mode <%s>, expected %s or %s", onFailure, ON_FAILURE_STOP, ON_FAILURE_ROLLBACK)
+	}
+	started := [][]string{}
+	for i := 0; i < len(stages); i++ {
+		stageStarted, failed := r.runStage(stages[i])
+		started = append(started, stageStarted)
+		if failed == 0 {
+			continue
+		}
+		err := fmt.Errorf("stage %d: %d of %d workers failed to start", i+1, failed, len(stages[i]))
+		if left := len(stages) - i - 1; left != 0 {
+			err = fmt.Errorf("%w, %d later stages not started", err, left)
+		}
+		if onFailure == ON_FAILURE_ROLLBACK {
+			err = errors.Join(err, rollback(started))
+		}
+		return err
+	}
+	return nil
+}
+
+// runStage starts the workers of the stage in parallel and returns the workers
+// started by it and the number of workers that failed.
+func (r *Runner) runStage(names []string) ([]string, int) {
+	started := make([]bool, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i := 0; i < len(names); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			started[i], errs[i] = r.startAndWait(names[i])
+		}(i)
+	}
+	wg.Wait()
+
+	stageStarted := []string{}
+	failed := 0
+	for i := 0; i < len(names); i++ {
+		switch {
+		case errs[i] != nil:
+			failed++
+			fmt.Printf("%s: %s\n", names[i], errs[i])
+		case started[i]:
+			stageStarted = append(stageStarted, names[i])
+			fmt.Printf("%s: started\n", names[i])
+		default:
+			fmt.Printf("%s: already active\n", names[i])
+		}
+	}
+	return stageStarted, failed
+}
+
+// startAndWait runs the worker and waits for its job if the start waits for
+// dependencies. It reports false for a worker that is already active.
+func (r *Runner) startAndWait(name string) (bool, error) {
+	workerStatus, err := status.CheckStatus(name)
+	if err != nil {
+		return false, err
+	}
+	if workerStatus.Active {
+		return false, nil
+	}
+	results, err := sendAction(dmnsocket.Request{Action: "run", Name: name, Deadline: r.deadline()})
+	if err != nil {
+		return false, err
+	}
+	// Every replica of a replicated worker waits for its dependencies in a job of its own.
+	for i := 0; i < len(results); i++ {
+		if results[i].Job == 0 {
+			continue
+		}
+		if err := waitJob(results[i].Job); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// waitJob waits until the job has started its worker.
+func waitJob(id int) error {
+	for {
+		job, err := jobs.GetJob(id)
+		if err != nil {
+			return err
+		}
+		switch job.State {
+		case jobs.STATE_STARTED:
+			return nil
+		case jobs.STATE_FAILED, jobs.STATE_CANCELLED:
+			return fmt.Errorf("job %d %s: %s", job.ID, job.State, job.Error)
+		}
+		time.Sleep(config.JOB_POLL_INTERVAL)
+	}
+}
+
+// rollback stops the started workers that are still active.
+func rollback(started [][]string) error {
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		for j := 0; j < len(started[i]); j++ {
+			name := started[i][j]
+			workerStatus, err := status.CheckStatus(name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rollback of %s: %w", name, err))
+				continue
+			}
+			if !workerStatus.Active {
+				continue
+			}
+			if _, err := sendAction(dmnsocket.Request{Action: "stop", Name: name}); err != nil {
+				errs = append(errs, fmt.Errorf("rollback of %s: %w", name, err))
+				continue
+			}
+			fmt.Printf("%s: stopped\n", name)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunAndWait runs the worker and waits until it exits. A job worker exits once it
+// is complete or has failed. It returns the final status of the worker.
+func (r *Runner) RunAndWait(name string) (*status.WorkerStatusData, error) {
+	if !r.workerExists(name) {
+		return nil, fmt.Errorf("worker <%s> not exists", name)
+	}
+	if _, err := r.startAndWait(name); err != nil {
+		return nil, err
+	}
+	for {
+		workerStatus, err := status.CheckStatus(name)
+		if err != nil {
+			return nil, err
+		}
+		if !workerStatus.Active {
+			return workerStatus, nil
+		}
+		time.Sleep(config.JOB_POLL_INTERVAL)
+	}
+}
@@ -1,11 +1,18 @@
 package runner
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/uwine4850/anthill/pkg/config"
 	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
 	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
 	"github.com/uwine4850/anthill/pkg/infra/socket"
 	"github.com/uwine4850/anthill/pkg/infra/status"
@@ -15,6 +22,7 @@ type Runner struct {
 	workersPath   string
 	workersConfig *parsecnf.WorkersConfig
 	wg            sync.WaitGroup
+	timeout       time.Duration
 }
 
 func NewRunner(workersPath string) Runner {
@@ -24,7 +32,7 @@ func NewRunner(workersPath string) Runner {
 }
 
 func (r *Runner) Init() error {
-	w, err := parsecnf.ParseWorkers("workers.yaml")
+	w, err := parsecnf.ParseWorkers(r.workersPath)
 	if err != nil {
 		return err
 	}
@@ -36,32 +44,17 @@ func (r *Runner) Wait() {
 	r.wg.Wait()
 }
 
-func (r *Runner) RunAllWorkers() error {
-	workersConfig := r.workersConfig.Workers
-	for i := 0; i < len(workersConfig); i++ {
-		workerStatus, err := status.CheckStatus(workersConfig[i].Name)
-		if err != nil {
-			return err
-		}
-		if workerStatus.Active {
-			fmt.Printf("worker %s already active\n", workersConfig[i].Name)
-		}
-		r.wg.Add(1)
-		go func(name string) {
-			defer r.wg.Done()
-			conn, err := socket.ConnectToOrchestrator()
-			if err != nil {
-				log.Fatal(err)
-			}
-			defer conn.Close()
+// SetTimeout limits how long the orchestrator waits for the dependencies of the
+// started workers. Zero waits without a limit.
+func (r *Runner) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
 
-			req := dmnsocket.Request{Action: "run", Name: workersConfig[i].Name}
-			if err := socket.SendRequest(conn, req); err != nil {
-				log.Fatal("failed to send request:", err)
-			}
-		}(workersConfig[i].Name)
+func (r *Runner) deadline() time.Time {
+	if r.timeout <= 0 {
+		return time.Time{}
 	}
-	return nil
+	return time.Now().Add(r.timeout)
 }
 
 func (r *Runner) RunWorker(name string) error {
@@ -72,27 +65,30 @@ func (r *Runner) RunWorker(name string) error {
 	if workerStatus.Active {
 		fmt.Printf("worker %s already active\n", name)
 	}
-	for i := 0; i < len(r.workersConfig.Workers); i++ {
-		workerConfig := r.workersConfig.Workers[i]
-		if workerConfig.Name == name {
-			r.wg.Add(1)
-			go func() {
-				defer r.wg.Done()
-				conn, err := socket.ConnectToOrchestrator()
-				if err != nil {
-					log.Fatal(err)
-				}
-				defer conn.Close()
-
-				req := dmnsocket.Request{Action: "run", Name: name}
-				if err := socket.SendRequest(conn, req); err != nil {
-					log.Fatal("failed to send request:", err)
-				}
-			}()
-		} else {
-			log.Fatalf("worker <%s> not exists\n", name)
-		}
+	if !r.workerExists(name) {
+		log.Fatalf("worker <%s> not exists\n", name)
 	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		conn, err := socket.ConnectToOrchestrator()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer conn.Close()
+
+		req := dmnsocket.Request{Action: "run", Name: name, Deadline: r.deadline()}
+		setDeadline(conn, req)
+		if err := socket.SendRequest(conn, req); err != nil {
+			log.Fatal("failed to send request:", err)
+		}
+		resp, err := readResponse(conn)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		printJobs(resp.Results)
+	}()
 	return err
 }
 
@@ -103,16 +99,149 @@ func (r *Runner) StopWorker(name string) error {
 	}
 	defer conn.Close()
 
+	if !r.workerExists(name) {
+		return fmt.Errorf("worker <%s> not exists", name)
+	}
+	req := dmnsocket.Request{Action: "stop", Name: name}
+	if err := socket.SendRequest(conn, req); err != nil {
+		log.Fatal("failed to send request:", err)
+	}
+	if _, err := readResponse(conn); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *Runner) StopAllWorkers() ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "stop", All: true})
+}
+
+func (r *Runner) RestartWorker(name string) ([]dmnsocket.WorkerResult, error) {
+	if !r.workerExists(name) {
+		return nil, fmt.Errorf("worker <%s> not exists", name)
+	}
+	return sendAction(dmnsocket.Request{Action: "restart", Name: name})
+}
+
+// RestartAllWorkers restarts every worker, parallel workers at a time.
+func (r *Runner) RestartAllWorkers(parallel int) ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "restart", All: true, Parallel: parallel})
+}
+
+func (r *Runner) RunSelector(selector string) ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "run", Selector: selector, Deadline: r.deadline()})
+}
+
+func (r *Runner) StopSelector(selector string) ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "stop", Selector: selector})
+}
+
+func (r *Runner) RestartSelector(selector string, parallel int) ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "restart", Selector: selector, Parallel: parallel})
+}
+
+// LogTargets returns the stream sockets of the workers matched by the selector, or of all workers.
+func (r *Runner) LogTargets(selector string, all bool) ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "logs", Selector: selector, All: all})
+}
+
+// LogDir returns the log directory of the worker or of its parent if it is a replica.
+func (r *Runner) LogDir(name string) (string, error) {
+	if r.workersConfig == nil {
+		return "", fmt.Errorf("log files of <%s> are only readable on the orchestrator host", name)
+	}
 	for i := 0; i < len(r.workersConfig.Workers); i++ {
 		workerConfig := r.workersConfig.Workers[i]
-		if workerConfig.Name == name {
-			req := dmnsocket.Request{Action: "stop", Name: name}
-			if err := socket.SendRequest(conn, req); err != nil {
-				log.Fatal("failed to send request:", err)
+		if isInstance(workerConfig, name) {
+			if workerConfig.Log.Dir == "" {
+				return "", fmt.Errorf("worker <%s> has no log directory", name)
 			}
-		} else {
-			return fmt.Errorf("worker <%s> not exists", name)
+			return workerConfig.Log.Dir, nil
 		}
 	}
-	return nil
+	return "", fmt.Errorf("worker <%s> not exists", name)
+}
+
+// ScaleWorker changes the number of replicas of the worker at runtime.
+func (r *Runner) ScaleWorker(name string, replicas int) ([]dmnsocket.WorkerResult, error) {
+	if !r.workerExists(name) {
+		return nil, fmt.Errorf("worker <%s> not exists", name)
+	}
+	return sendAction(dmnsocket.Request{Action: "scale", Name: name, Replicas: replicas})
+}
+
+// Reload makes the orchestrator read the workers and plugins configs again.
+func (r *Runner) Reload() ([]dmnsocket.WorkerResult, error) {
+	return sendAction(dmnsocket.Request{Action: "reload"})
+}
+
+// workerExists reports whether name is a configured worker or one of its replicas.
+// Replicas added at runtime by scaling are accepted by their parent prefix, every
+// worker can be scaled. Without a local config the orchestrator checks the name.
+func (r *Runner) workerExists(name string) bool {
+	if r.workersConfig == nil {
+		return true
+	}
+	for i := 0; i < len(r.workersConfig.Workers); i++ {
+		if isInstance(r.workersConfig.Workers[i], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInstance reports whether name is the worker or one of its replicas.
+func isInstance(workerConfig dmnworker.WorkerConfig, name string) bool {
+	if workerConfig.Name == name {
+		return true
+	}
+	index, ok := strings.CutPrefix(name, workerConfig.Name+"-")
+	_, err := strconv.Atoi(index)
+	return ok && err == nil
+}
+
+func sendAction(req dmnsocket.Request) ([]dmnsocket.WorkerResult, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	setDeadline(conn, req)
+	if err := socket.SendRequest(conn, req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %s", err)
+	}
+	resp, err := readResponse(conn)
+	if resp == nil {
+		return nil, err
+	}
+	return resp.Results, err
+}
+
+// printJobs reports the workers whose start waits for their dependencies.
+func printJobs(results []dmnsocket.WorkerResult) {
+	for _, result := range results {
+		if result.Job != 0 {
+			fmt.Printf("worker %s waits for its dependencies, job %d\n", result.Name, result.Job)
+		}
+	}
+}
+
+// setDeadline gives up on the connection a little after the deadline of the request,
+// so the client still reads the error of a request cancelled by the orchestrator.
+func setDeadline(conn net.Conn, req dmnsocket.Request) {
+	if !req.Deadline.IsZero() {
+		conn.SetDeadline(req.Deadline.Add(config.DEADLINE_GRACE))
+	}
+}
+
+func readResponse(conn net.Conn) (*dmnsocket.Response, error) {
+	var resp dmnsocket.Response
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return &resp, errors.New(resp.Error)
+	}
+	return &resp, nil
 }
@@ -0,0 +1,115 @@
+package selector
+
+import (
+	"fmt"
+	"strings"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key   string
+	op    operator
+	value string
+}
+
+// Selector matches workers by their labels. The worker name and group are
+// available as the implicit labels "name" and "group".
+type Selector struct {
+	requirements []requirement
+}
+
+// Parse parses a comma separated list of requirements such as
+// "group=ingest,env!=dev,tier,!canary".
+func Parse(s string) (*Selector, error) {
+	sel := &Selector{}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		req, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		sel.requirements = append(sel.requirements, req)
+	}
+	if len(sel.requirements) == 0 {
+		return nil, fmt.Errorf("empty selector <%s>", s)
+	}
+	return sel, nil
+}
+
+func parseRequirement(term string) (requirement, error) {
+	var req requirement
+	switch {
+	case strings.Contains(term, "!="):
+		key, value, _ := strings.Cut(term, "!=")
+		req = requirement{key: key, op: opNotEquals, value: value}
+	case strings.Contains(term, "=="):
+		key, value, _ := strings.Cut(term, "==")
+		req = requirement{key: key, op: opEquals, value: value}
+	case strings.Contains(term, "="):
+		key, value, _ := strings.Cut(term, "=")
+		req = requirement{key: key, op: opEquals, value: value}
+	case strings.HasPrefix(term, "!"):
+		req = requirement{key: term[1:], op: opNotExists}
+	default:
+		req = requirement{key: term, op: opExists}
+	}
+	req.key = strings.TrimSpace(req.key)
+	req.value = strings.TrimSpace(req.value)
+	if req.key == "" {
+		return requirement{}, fmt.Errorf("invalid selector requirement <%s>", term)
+	}
+	return req, nil
+}
+
+func (s *Selector) Matches(workerConfig dmnworker.WorkerConfig) bool {
+	labels := Labels(workerConfig)
+	for i := 0; i < len(s.requirements); i++ {
+		req := s.requirements[i]
+		value, ok := labels[req.key]
+		switch req.op {
+		case opEquals:
+			if !ok || value != req.value {
+				return false
+			}
+		case opNotEquals:
+			if ok && value == req.value {
+				return false
+			}
+		case opExists:
+			if !ok {
+				return false
+			}
+		case opNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Labels returns the labels of the worker together with its implicit labels.
+func Labels(workerConfig dmnworker.WorkerConfig) map[string]string {
+	labels := make(map[string]string, len(workerConfig.Labels)+2)
+	for key, value := range workerConfig.Labels {
+		labels[key] = value
+	}
+	labels["name"] = workerConfig.Name
+	if workerConfig.Group != "" {
+		labels["group"] = workerConfig.Group
+	}
+	return labels
+}
@@ -0,0 +1,44 @@
+package socket
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// ListenUnix listens on the unix socket at path. The socket is bound in a
+// directory only the owner can enter and moved to path once prepare has set
+// its permissions, so no other user can connect before. The socket file is
+// removed when the listener is closed.
+func ListenUnix(path string, prepare func(path string) error) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".anthill-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := prepare(tmp); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &unixListener{Listener: listener, path: path}, nil
+}
+
+type unixListener struct {
+	net.Listener
+	path string
+}
+
+func (l *unixListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
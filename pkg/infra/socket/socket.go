@@ -1,14 +1,44 @@
 package socket
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"os"
 
 	"github.com/uwine4850/anthill/pkg/config"
 )
 
+// Target is the orchestrator the client connects to. A target without a host is
+// the local unix socket, otherwise the host is dialed over TCP with TLS.
+type Target struct {
+	Host string
+	// CA verifies the orchestrator certificate, Cert and Key are the client certificate.
+	CA         string
+	Cert       string
+	Key        string
+	ServerName string
+}
+
+var target Target
+
+// SetTarget sets the orchestrator of all later connections.
+func SetTarget(t Target) {
+	target = t
+}
+
+// IsRemote reports whether the orchestrator is reached over TCP.
+func IsRemote() bool {
+	return target.Host != ""
+}
+
 func ConnectToOrchestrator() (net.Conn, error) {
+	if IsRemote() {
+		return connectTLS(target)
+	}
 	conn, err := net.Dial("unix", config.ANTHILL_SOCKET_PATH)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to orchestrator: %s", err)
@@ -16,8 +46,44 @@ func ConnectToOrchestrator() (net.Conn, error) {
 	return conn, nil
 }
 
-func SendRequest(conn net.Conn, req any) error {
-	enc := json.NewEncoder(conn)
+func connectTLS(t Target) (net.Conn, error) {
+	tlsConfig := &tls.Config{ServerName: t.ServerName}
+	if t.CA != "" {
+		pool, err := LoadCertPool(t.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if t.Cert != "" || t.Key != "" {
+		cert, err := tls.LoadX509KeyPair(t.Cert, t.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	conn, err := tls.Dial("tcp", t.Host, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to orchestrator %s: %s", t.Host, err)
+	}
+	return conn, nil
+}
+
+// LoadCertPool reads the PEM certificates of the file.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func SendRequest(w io.Writer, req any) error {
+	enc := json.NewEncoder(w)
 	err := enc.Encode(req)
 	if err != nil {
 		return err
@@ -3,27 +3,42 @@ package status
 import (
 	"errors"
 	"fmt"
-	"net"
+	"io"
+	"maps"
+	"sort"
+	"sync"
 	"time"
 
 	dmnsocket "github.com/uwine4850/anthill/pkg/domain/dmn_socket"
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
 	"github.com/uwine4850/anthill/pkg/infra/parsecnf"
 	"github.com/uwine4850/anthill/pkg/infra/socket"
 )
 
 type Status interface {
 	Init(workersConfig *parsecnf.WorkersConfig)
+	Add(name string, parent string, replica int)
+	Remove(name string)
 	SetRunning(name string) error
 	SetStopped(name string) error
 	SetDone(name string) error
+	SetFailed(name string, exitCode int, reason string) error
+	SetReady(name string) error
 	Get() map[string]WorkerStatusData
 }
 
 type WorkerStatusData struct {
-	Name   string
-	Active bool
-	UpDate time.Time
-	Done   bool
+	Name     string
+	Active   bool
+	UpDate   time.Time
+	Done     bool
+	Ready    bool               `json:",omitempty"`
+	Failed   bool               `json:",omitempty"`
+	ExitCode int                `json:",omitempty"`
+	Error    string             `json:",omitempty"`
+	Parent   string             `json:",omitempty"`
+	Replica  int                `json:",omitempty"`
+	Replicas []WorkerStatusData `json:",omitempty"`
 }
 
 type StatusResponse struct {
@@ -32,6 +47,7 @@ type StatusResponse struct {
 }
 
 type WorkerStatus struct {
+	mu               sync.RWMutex
 	workerAntsStatus map[string]WorkerStatusData
 }
 
@@ -42,19 +58,54 @@ func NewStatus() *WorkerStatus {
 }
 
 func (s *WorkerStatus) Init(workersConfig *parsecnf.WorkersConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for i := 0; i < len(workersConfig.Workers); i++ {
 		w := workersConfig.Workers[i]
-		s.workerAntsStatus[w.Name] = WorkerStatusData{
-			Name: w.Name,
+		if w.Replicas <= 0 {
+			s.workerAntsStatus[w.Name] = WorkerStatusData{
+				Name: w.Name,
+			}
+			continue
 		}
+		for j, name := range dmnworker.InstanceNames(w) {
+			s.workerAntsStatus[name] = WorkerStatusData{
+				Name:    name,
+				Parent:  w.Name,
+				Replica: j,
+			}
+		}
+	}
+}
+
+func (s *WorkerStatus) Add(name string, parent string, replica int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workerAntsStatus[name] = WorkerStatusData{
+		Name:    name,
+		Parent:  parent,
+		Replica: replica,
 	}
 }
 
+func (s *WorkerStatus) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.workerAntsStatus, name)
+}
+
 func (s *WorkerStatus) SetRunning(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	w, ok := s.workerAntsStatus[name]
 	if ok {
 		w.Active = true
 		w.UpDate = time.Now()
+		w.Done = false
+		w.Ready = false
+		w.Failed = false
+		w.ExitCode = 0
+		w.Error = ""
 		s.workerAntsStatus[name] = w
 	} else {
 		return fmt.Errorf("worker %s not exists", name)
@@ -63,10 +114,13 @@ func (s *WorkerStatus) SetRunning(name string) error {
 }
 
 func (s *WorkerStatus) SetStopped(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	w, ok := s.workerAntsStatus[name]
 	if ok {
 		w.Active = false
 		w.UpDate = time.Time{}
+		w.Ready = false
 		s.workerAntsStatus[name] = w
 	} else {
 		return fmt.Errorf("worker %s not exists", name)
@@ -75,11 +129,34 @@ func (s *WorkerStatus) SetStopped(name string) error {
 }
 
 func (s *WorkerStatus) SetDone(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	w, ok := s.workerAntsStatus[name]
 	if ok {
 		w.Active = false
 		w.UpDate = time.Time{}
 		w.Done = true
+		w.Ready = false
+		s.workerAntsStatus[name] = w
+	} else {
+		return fmt.Errorf("worker %s not exists", name)
+	}
+	return nil
+}
+
+// SetFailed marks the worker as exited with an error. A failed worker is not done,
+// so the workers that start after it are not started.
+func (s *WorkerStatus) SetFailed(name string, exitCode int, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workerAntsStatus[name]
+	if ok {
+		w.Active = false
+		w.UpDate = time.Time{}
+		w.Failed = true
+		w.Ready = false
+		w.ExitCode = exitCode
+		w.Error = reason
 		s.workerAntsStatus[name] = w
 	} else {
 		return fmt.Errorf("worker %s not exists", name)
@@ -88,23 +165,93 @@ func (s *WorkerStatus) SetDone(name string) error {
 }
 
 func (s *WorkerStatus) Get() map[string]WorkerStatusData {
-	return s.workerAntsStatus
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maps.Clone(s.workerAntsStatus)
+}
+
+// SetReady marks the running worker as ready, so the workers that start after_ready of it can start.
+func (s *WorkerStatus) SetReady(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w, ok := s.workerAntsStatus[name]
+	if ok {
+		if w.Active {
+			w.Ready = true
+			s.workerAntsStatus[name] = w
+		}
+	} else {
+		return fmt.Errorf("worker %s not exists", name)
+	}
+	return nil
+}
+
+// Aggregate groups the status of replicas under the name of their parent worker.
+// The parent is active if any replica is active, done or ready once all replicas are
+// done or ready and failed if any replica failed.
+func Aggregate(workersStatus map[string]WorkerStatusData) map[string]WorkerStatusData {
+	aggregated := make(map[string]WorkerStatusData, len(workersStatus))
+	replicas := map[string][]WorkerStatusData{}
+	for name, data := range workersStatus {
+		if data.Parent == "" {
+			aggregated[name] = data
+			continue
+		}
+		replicas[data.Parent] = append(replicas[data.Parent], data)
+	}
+	for parent, parentReplicas := range replicas {
+		sort.Slice(parentReplicas, func(i, j int) bool {
+			return parentReplicas[i].Replica < parentReplicas[j].Replica
+		})
+		data := WorkerStatusData{Name: parent, Done: true, Ready: true, Replicas: parentReplicas}
+		for i := 0; i < len(parentReplicas); i++ {
+			r := parentReplicas[i]
+			if r.Active {
+				data.Active = true
+				if data.UpDate.IsZero() || r.UpDate.Before(data.UpDate) {
+					data.UpDate = r.UpDate
+				}
+			}
+			if !r.Done {
+				data.Done = false
+			}
+			if !r.Ready {
+				data.Ready = false
+			}
+			if r.Failed && !data.Failed {
+				data.Failed = true
+				data.ExitCode = r.ExitCode
+				data.Error = r.Name + ": " + r.Error
+			}
+		}
+		aggregated[parent] = data
+	}
+	return aggregated
 }
 
-func SendResponse(conn net.Conn, status Status) error {
-	err := socket.SendRequest(conn, &StatusResponse{WorkerStatus: status.Get()})
+func SendResponse(w io.Writer, status Status) error {
+	err := socket.SendRequest(w, &StatusResponse{WorkerStatus: Aggregate(status.Get())})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func SendWorkerResponse(conn net.Conn, workerName string, status Status) error {
-	workerStatus, ok := status.Get()[workerName]
-	if !ok {
-		return fmt.Errorf("worker %s not exists", workerName)
+func SendWorkerResponse(w io.Writer, workerName string, status Status) error {
+	return SendWorkersResponse(w, []string{workerName}, status)
+}
+
+func SendWorkersResponse(w io.Writer, workerNames []string, status Status) error {
+	allStatus := status.Get()
+	workersStatus := make(map[string]WorkerStatusData, len(workerNames))
+	for i := 0; i < len(workerNames); i++ {
+		workerStatus, ok := allStatus[workerNames[i]]
+		if !ok {
+			return fmt.Errorf("worker %s not exists", workerNames[i])
+		}
+		workersStatus[workerNames[i]] = workerStatus
 	}
-	err := socket.SendRequest(conn, &StatusResponse{WorkerStatus: map[string]WorkerStatusData{workerName: workerStatus}})
+	err := socket.SendRequest(w, &StatusResponse{WorkerStatus: Aggregate(workersStatus)})
 	if err != nil {
 		return err
 	}
@@ -125,15 +272,27 @@ func CheckAllStatus() error {
 	if err := socket.ReadRequest(conn, &resp); err != nil {
 		return err
 	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
 
 	for _, status := range resp.WorkerStatus {
-		f, err := fmt.Printf("Name: %s | Active: %v, | UpDate: %s", status.Name, status.Active, status.UpDate.Format("2006-01-02 15:04"))
-		if err != nil {
-			return err
+		fmt.Printf("Name: %s | Active: %v, | Ready: %v | UpDate: %s%s\n", status.Name, status.Active, status.Ready, status.UpDate.Format("2006-01-02 15:04"), FailureText(status))
+		for i := 0; i < len(status.Replicas); i++ {
+			replica := status.Replicas[i]
+			fmt.Printf("  Replica: %s | Active: %v, | UpDate: %s%s\n", replica.Name, replica.Active, replica.UpDate.Format("2006-01-02 15:04"), FailureText(replica))
 		}
-		fmt.Println(f)
 	}
-	return err
+	return nil
+}
+
+// FailureText describes the failure of the worker for the status lines, it is empty
+// for a worker that did not fail.
+func FailureText(status WorkerStatusData) string {
+	if !status.Failed {
+		return ""
+	}
+	return fmt.Sprintf(" | Failed: exit code %d: %s", status.ExitCode, status.Error)
 }
 
 func CheckStatus(name string) (*WorkerStatusData, error) {
@@ -155,6 +314,37 @@ func CheckStatus(name string) (*WorkerStatusData, error) {
 	if resp.Error != "" {
 		return nil, errors.New(resp.Error)
 	}
-	w := resp.WorkerStatus[name]
-	return &w, nil
+	for _, w := range resp.WorkerStatus {
+		if w.Name == name {
+			return &w, nil
+		}
+		for i := 0; i < len(w.Replicas); i++ {
+			if w.Replicas[i].Name == name {
+				return &w.Replicas[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("worker %s not exists", name)
+}
+
+func CheckSelectorStatus(selector string) (map[string]WorkerStatusData, error) {
+	conn, err := socket.ConnectToOrchestrator()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := dmnsocket.Request{Action: "status", Selector: selector}
+	if err := socket.SendRequest(conn, &req); err != nil {
+		return nil, err
+	}
+
+	var resp StatusResponse
+	if err := socket.ReadRequest(conn, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.WorkerStatus, nil
 }
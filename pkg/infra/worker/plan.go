@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
+)
+
+// PlanStages orders the instances of the workers in stages. A worker is placed in the
+// stage after the last of its dependencies, so the workers of a stage can start in parallel.
+func PlanStages(workers []dmnworker.WorkerConfig) ([][]string, error) {
+	index := make(map[string]int, len(workers))
+	for i := 0; i < len(workers); i++ {
+		index[workers[i].Name] = i
+	}
+	stage := make([]int, len(workers))
+	visiting := make([]bool, len(workers))
+	var visit func(i int, path []string) (int, error)
+	visit = func(i int, path []string) (int, error) {
+		if stage[i] != 0 {
+			return stage[i], nil
+		}
+		path = append(path, workers[i].Name)
+		if visiting[i] {
+			return 0, fmt.Errorf("dependency cycle %s", strings.Join(path, " -> "))
+		}
+		visiting[i] = true
+		s := 1
+		dependencies := slices.Concat(workers[i].After, workers[i].AfterReady)
+		for j := 0; j < len(dependencies); j++ {
+			dependencyStage, err := visit(index[dependencies[j]], path)
+			if err != nil {
+				return 0, err
+			}
+			s = max(s, dependencyStage+1)
+		}
+		visiting[i] = false
+		stage[i] = s
+		return s, nil
+	}
+
+	stages := [][]string{}
+	for i := 0; i < len(workers); i++ {
+		s, err := visit(i, nil)
+		if err != nil {
+			return nil, err
+		}
+		for len(stages) < s {
+			stages = append(stages, []string{})
+		}
+		stages[s-1] = append(stages[s-1], dmnworker.InstanceNames(workers[i])...)
+	}
+	return stages, nil
+}
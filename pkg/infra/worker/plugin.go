@@ -2,42 +2,75 @@ package worker
 
 import (
 	"fmt"
+	"log"
 
 	dmnworker "github.com/uwine4850/anthill/pkg/domain/dmn_worker"
 	"github.com/uwine4850/anthill/pkg/infra/plug"
 )
 
-func ExtractPluginAntsFromPlugins(pluginsConfig dmnworker.PluginsConfig) (map[string]dmnworker.PluginAnt, error) {
-	builtinList, err := plug.BuiltinList()
+// ExtractPluginAntsFromPlugins loads every discovered plugin. A plugin that cannot be loaded
+// is reported in its PluginInfo and skipped so that one broken plugin does not stop the orchestrator.
+func ExtractPluginAntsFromPlugins(pluginsConfig dmnworker.PluginsConfig) (map[string]dmnworker.PluginAnt, []dmnworker.PluginInfo, error) {
+	plugins, err := plug.Discover(pluginsConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	pluginsList := append(pluginsConfig.Plugins, builtinList...)
 
-	pluginAnts := make(map[string]dmnworker.PluginAnt, len(pluginsList))
-	for i := 0; i < len(pluginsList); i++ {
-		pluginPath := pluginsList[i]
-		workerAnt, err := WorkerAntFromPlugin(pluginPath)
+	pluginAnts := make(map[string]dmnworker.PluginAnt, len(plugins))
+	for i := 0; i < len(plugins); i++ {
+		if plugins[i].Error != "" {
+			log.Printf("skip plugin %s: %s\n", plugins[i].Path, plugins[i].Error)
+			continue
+		}
+		pluginPath := plugins[i].Path
+		workerAnt, metadata, err := loadPlugin(pluginPath)
 		if err != nil {
-			return nil, err
+			plugins[i].Error = err.Error()
+			log.Printf("skip plugin %s: %s\n", pluginPath, err)
+			continue
 		}
-		if _, ok := pluginAnts[workerAnt.Type()]; !ok {
-			pluginAnts[workerAnt.Type()] = dmnworker.PluginAnt{
-				Path:      pluginPath,
-				WorkerAnt: workerAnt,
+		// Executable plugins are only started here to read their type, the
+		// launcher starts them again for every worker run.
+		if execPlugin, ok := workerAnt.(*plug.ExecPlugin); ok {
+			if err := execPlugin.Close(); err != nil {
+				log.Printf("close plugin %s: %s\n", pluginPath, err)
 			}
-		} else {
-			return nil, fmt.Errorf("WorkerAnt type %s already exists", workerAnt.Type())
+		}
+		plugins[i].Type = workerAnt.Type()
+		plugins[i].Name = metadata.Name
+		plugins[i].Version = metadata.Version
+		if existing, ok := pluginAnts[workerAnt.Type()]; ok {
+			plugins[i].Error = fmt.Sprintf("WorkerAnt type %s already provided by %s", workerAnt.Type(), existing.Path)
+			log.Printf("skip plugin %s: %s\n", pluginPath, plugins[i].Error)
+			continue
+		}
+		pluginAnts[workerAnt.Type()] = dmnworker.PluginAnt{
+			Path:      pluginPath,
+			Metadata:  *metadata,
+			WorkerAnt: workerAnt,
 		}
 	}
-	return pluginAnts, nil
+	return pluginAnts, plugins, nil
 }
 
 func WorkerAntFromPlugin(path string) (dmnworker.WorkerAnt, error) {
-	plugin, err := plug.OpenPlugin(path)
+	workerAnt, _, err := loadPlugin(path)
+	return workerAnt, err
+}
+
+// loadPlugin loads a Go .so plugin or starts an executable plugin.
+// An executable plugin stays running until it is closed.
+func loadPlugin(path string) (dmnworker.WorkerAnt, *dmnworker.PluginMetadata, error) {
+	if plug.IsExecPlugin(path) {
+		return plug.OpenExecPlugin(path)
+	}
+	plugin, metadata, err := plug.OpenPlugin(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	workerAnt, ok := (*plugin).(dmnworker.WorkerAnt)
+	if !ok {
+		return nil, nil, fmt.Errorf("plugin %s: symbol has type %T and does not implement WorkerAnt", path, *plugin)
 	}
-	workerAnt := (*plugin).(dmnworker.WorkerAnt)
-	return workerAnt, nil
+	return workerAnt, metadata, nil
 }
@@ -13,12 +13,31 @@ func CurrentAnts(workersConfig *parsecnf.WorkersConfig, allPluginAnts map[string
 		workerConfig := workersConfig.Workers[i]
 		if pluginAnt, ok := allPluginAnts[workerConfig.Type]; ok {
 			pluginAnt.Args = workerConfig.Args
+			pluginAnt.Env = workerConfig.Env
+			pluginAnt.Kind = workerConfig.Kind
+			pluginAnt.Job = workerConfig.Job
 			pluginAnt.Reload = workerConfig.Reload
 			pluginAnt.After = workerConfig.After
-			currentAnts[workerConfig.Name] = pluginAnt
+			pluginAnt.AfterReady = workerConfig.AfterReady
+			pluginAnt.Readiness = workerConfig.Readiness
+			pluginAnt.Log = workerConfig.Log
+			pluginAnt.Sinks = workerConfig.Sinks
+			if workerConfig.Replicas <= 0 {
+				currentAnts[workerConfig.Name] = pluginAnt
+				continue
+			}
+			for j := 0; j < workerConfig.Replicas; j++ {
+				currentAnts[dmnworker.ReplicaName(workerConfig.Name, j)] = ReplicaAnt(pluginAnt, workerConfig.Name, j)
+			}
 		} else {
 			return nil, fmt.Errorf("WorkerAnt for type %s not found", workerConfig.Type)
 		}
 	}
 	return currentAnts, nil
 }
+
+func ReplicaAnt(pluginAnt dmnworker.PluginAnt, parent string, index int) dmnworker.PluginAnt {
+	pluginAnt.Parent = parent
+	pluginAnt.Replica = index
+	return pluginAnt
+}